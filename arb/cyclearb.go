@@ -0,0 +1,97 @@
+package arb
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/icoolworld/trade/exchange"
+)
+
+// CycleArbStrategy 在一组可交易的货币对上寻找任意长度的套利环路，取代只盯死
+// FIL/ETH/BSV 三角的旧策略。图里的节点是币种，边是某个交易对的买一/卖一价
+// 隐含的换汇比率，只要图里存在负权环，就说明沿着这个环交易一圈能赚钱。
+type CycleArbStrategy struct {
+	Symbols     []string      // 参与建图的交易对，格式为 BASE-QUOTE
+	MaxCycleLen int           // 只关心不超过这个跳数的环，0 表示不限制
+	CostRate    float64       // 交易手续费率
+	SlipRate    float64       // 滑点率
+	Debounce    time.Duration // 两次重新检测之间的最小间隔
+
+	lastRun time.Time
+}
+
+// NewCycleArbStrategy 创建一个 N-环套利策略
+func NewCycleArbStrategy(symbols []string, maxCycleLen int, costRate, slipRate float64, debounce time.Duration) *CycleArbStrategy {
+	return &CycleArbStrategy{
+		Symbols:     symbols,
+		MaxCycleLen: maxCycleLen,
+		CostRate:    costRate,
+		SlipRate:    slipRate,
+		Debounce:    debounce,
+	}
+}
+
+// splitSymbol 把 BASE-QUOTE 格式的交易对符号拆成两个币种
+func splitSymbol(symbol string) (base, quote string, ok bool) {
+	parts := strings.SplitN(symbol, "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// buildGraph 把当前行情转换成货币图：卖一价贡献一条 quote->base 的边（花 quote 买 base），
+// 买一价贡献一条 base->quote 的边（卖 base 换 quote），两条边都已经扣过手续费和滑点
+func (s *CycleArbStrategy) buildGraph(tickers map[string]*exchange.Ticker) *Graph {
+	g := NewGraph()
+	factor := (1 - s.CostRate) * (1 - s.SlipRate)
+
+	for _, symbol := range s.Symbols {
+		ticker := tickers[symbol]
+		if ticker == nil || ticker.Ask <= 0 || ticker.Bid <= 0 {
+			continue
+		}
+		base, quote, ok := splitSymbol(symbol)
+		if !ok {
+			continue
+		}
+
+		askRate := (1 / ticker.Ask) * factor
+		g.AddEdge(Edge{From: quote, To: base, Weight: -math.Log(askRate), Rate: askRate, Symbol: symbol, Side: "ask"})
+
+		bidRate := ticker.Bid * factor
+		g.AddEdge(Edge{From: base, To: quote, Weight: -math.Log(bidRate), Rate: bidRate, Symbol: symbol, Side: "bid"})
+	}
+	return g
+}
+
+// Detect 在当前行情下寻找一条有利可图的套利环路，返回环上的边（按交易顺序排列）
+// 以及沿着这个环交易一圈的预期收益倍数（大于 1 才有利可图）。两次检测之间至少
+// 间隔 Debounce 时间，避免行情一有风吹草动就重新跑一遍 Bellman-Ford。
+func (s *CycleArbStrategy) Detect(tickers map[string]*exchange.Ticker, now time.Time) (cycle []Edge, profitRatio float64, ok bool) {
+	if !s.lastRun.IsZero() && now.Sub(s.lastRun) < s.Debounce {
+		return nil, 0, false
+	}
+	s.lastRun = now
+
+	g := s.buildGraph(tickers)
+	maxLen := s.MaxCycleLen
+	if maxLen <= 0 {
+		maxLen = len(g.Nodes())
+	}
+
+	edges, found := g.NegativeCycle(maxLen)
+	if !found {
+		return nil, 0, false
+	}
+
+	profitRatio = 1
+	for _, e := range edges {
+		profitRatio *= e.Rate
+	}
+	if profitRatio <= 1 {
+		return nil, 0, false
+	}
+	return edges, profitRatio, true
+}
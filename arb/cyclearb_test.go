@@ -0,0 +1,87 @@
+package arb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/icoolworld/trade/exchange"
+)
+
+func ticker(symbol string, bid, ask float64) *exchange.Ticker {
+	return &exchange.Ticker{Symbol: symbol, Bid: bid, Ask: ask}
+}
+
+func TestDetect_ThreeHopCycle(t *testing.T) {
+	tickers := map[string]*exchange.Ticker{
+		"X-Y": ticker("X-Y", 2.0, 2.02),
+		"Y-Z": ticker("Y-Z", 2.0, 2.02),
+		"X-Z": ticker("X-Z", 0.19, 0.2),
+	}
+
+	s := NewCycleArbStrategy([]string{"X-Y", "Y-Z", "X-Z"}, 3, 0.001, 0.0001, 0)
+	cycle, profitRatio, ok := s.Detect(tickers, time.Unix(0, 0))
+	if !ok {
+		t.Fatalf("expected a profitable cycle to be found")
+	}
+	if len(cycle) != 3 {
+		t.Fatalf("expected a 3-hop cycle, got %d hops: %+v", len(cycle), cycle)
+	}
+	if profitRatio <= 1 {
+		t.Fatalf("expected profitRatio > 1, got %f", profitRatio)
+	}
+}
+
+func TestDetect_FourHopCycle(t *testing.T) {
+	tickers := map[string]*exchange.Ticker{
+		"A-B": ticker("A-B", 2.0, 2.02),
+		"B-C": ticker("B-C", 2.0, 2.02),
+		"C-D": ticker("C-D", 2.0, 2.02),
+		"A-D": ticker("A-D", 0.12, 0.125),
+	}
+
+	s := NewCycleArbStrategy([]string{"A-B", "B-C", "C-D", "A-D"}, 4, 0.001, 0.0001, 0)
+	cycle, profitRatio, ok := s.Detect(tickers, time.Unix(0, 0))
+	if !ok {
+		t.Fatalf("expected a profitable cycle to be found")
+	}
+	if len(cycle) != 4 {
+		t.Fatalf("expected a 4-hop cycle, got %d hops: %+v", len(cycle), cycle)
+	}
+	if profitRatio <= 1 {
+		t.Fatalf("expected profitRatio > 1, got %f", profitRatio)
+	}
+}
+
+func TestDetect_NoArbitrage(t *testing.T) {
+	tickers := map[string]*exchange.Ticker{
+		"X-Y": ticker("X-Y", 2.0, 2.02),
+		"Y-Z": ticker("Y-Z", 3.0, 3.03),
+		"X-Z": ticker("X-Z", 5.9, 6.15),
+	}
+
+	s := NewCycleArbStrategy([]string{"X-Y", "Y-Z", "X-Z"}, 3, 0.001, 0.0001, 0)
+	_, _, ok := s.Detect(tickers, time.Unix(0, 0))
+	if ok {
+		t.Fatalf("expected no arbitrage cycle to be found")
+	}
+}
+
+func TestDetect_Debounce(t *testing.T) {
+	tickers := map[string]*exchange.Ticker{
+		"X-Y": ticker("X-Y", 2.0, 2.02),
+		"Y-Z": ticker("Y-Z", 2.0, 2.02),
+		"X-Z": ticker("X-Z", 0.19, 0.2),
+	}
+
+	s := NewCycleArbStrategy([]string{"X-Y", "Y-Z", "X-Z"}, 3, 0.001, 0.0001, time.Minute)
+	now := time.Unix(0, 0)
+	if _, _, ok := s.Detect(tickers, now); !ok {
+		t.Fatalf("expected first call to run and find a cycle")
+	}
+	if _, _, ok := s.Detect(tickers, now.Add(time.Second)); ok {
+		t.Fatalf("expected second call within the debounce window to be skipped")
+	}
+	if _, _, ok := s.Detect(tickers, now.Add(2*time.Minute)); !ok {
+		t.Fatalf("expected call after the debounce window to run again")
+	}
+}
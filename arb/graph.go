@@ -0,0 +1,117 @@
+package arb
+
+// Edge 是货币图中的一条有向边：从 From 币种换到 To 币种，Weight 是 -log(rate)，
+// Rate 是这条边实际的换汇比率（已经扣除手续费和滑点），Symbol/Side 记录了这条边
+// 对应哪个交易对的哪一侧，用于把找到的负环还原成可执行的交易路径
+type Edge struct {
+	From   string
+	To     string
+	Weight float64
+	Rate   float64
+	Symbol string
+	Side   string // "ask" 或 "bid"
+}
+
+// Graph 是一个货币图，节点是币种，边是某个交易对买一/卖一价隐含的换汇关系
+type Graph struct {
+	adjacency map[string][]Edge
+	nodes     map[string]bool
+}
+
+// NewGraph 创建一个空的货币图
+func NewGraph() *Graph {
+	return &Graph{
+		adjacency: make(map[string][]Edge),
+		nodes:     make(map[string]bool),
+	}
+}
+
+// AddEdge 往图里加一条边，会自动把 From/To 注册为节点
+func (g *Graph) AddEdge(e Edge) {
+	g.adjacency[e.From] = append(g.adjacency[e.From], e)
+	g.nodes[e.From] = true
+	g.nodes[e.To] = true
+}
+
+// Nodes 返回图中所有的币种节点
+func (g *Graph) Nodes() []string {
+	nodes := make([]string, 0, len(g.nodes))
+	for n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// NegativeCycle 用 Bellman-Ford 在图中寻找一个负权环。为了不用对每个节点都跑一遍，
+// 这里用 Johnson 算法里的技巧：引入一个虚拟源点，以权重 0 连到图里的每一个节点，
+// 再从这个虚拟源点跑一次 Bellman-Ford，就能发现从任意节点可达的负环。
+// 返回的 cycle 按边在环上的顺序排列；maxLen 限制环的最大跳数，超出的负环会被丢弃
+// （长环在实盘里滑点和执行风险都更大，不值得追）。
+func (g *Graph) NegativeCycle(maxLen int) ([]Edge, bool) {
+	nodes := g.Nodes()
+	if len(nodes) == 0 {
+		return nil, false
+	}
+
+	dist := make(map[string]float64, len(nodes)+1)
+	pred := make(map[string]*Edge, len(nodes))
+	for _, n := range nodes {
+		dist[n] = 0 // 虚拟源点到每个节点的初始距离都是 0，相当于加了一条权重 0 的边
+	}
+
+	var lastRelaxed *Edge
+	for i := 0; i < len(nodes); i++ {
+		lastRelaxed = nil
+		for _, u := range nodes {
+			for _, e := range g.adjacency[u] {
+				if dist[u]+e.Weight < dist[e.To] {
+					dist[e.To] = dist[u] + e.Weight
+					edge := e
+					pred[e.To] = &edge
+					lastRelaxed = &edge
+				}
+			}
+		}
+	}
+
+	if lastRelaxed == nil {
+		return nil, false // 迭代 |V| 轮后还能继续松弛，说明存在负环；这里没有松弛，说明没有
+	}
+
+	// 松弛在第 |V| 轮仍然发生，说明 lastRelaxed.To 在负环上（或者能被负环影响到），
+	// 从它开始沿 pred 指针再往回走 |V| 步，一定能落到环内的某个节点上
+	node := lastRelaxed.To
+	for i := 0; i < len(nodes); i++ {
+		if e, ok := pred[node]; ok {
+			node = e.From
+		}
+	}
+
+	cycle := make([]Edge, 0, maxLen)
+	visited := map[string]bool{node: true}
+	cur := node
+	for {
+		e, ok := pred[cur]
+		if !ok {
+			return nil, false
+		}
+		cycle = append(cycle, *e)
+		if len(cycle) > maxLen {
+			return nil, false
+		}
+		cur = e.From
+		if cur == node {
+			break
+		}
+		if visited[cur] {
+			return nil, false // 理论上不会发生，保险起见避免死循环
+		}
+		visited[cur] = true
+	}
+
+	// pred 链是反着记录的，翻转成沿环正向的顺序
+	for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+		cycle[i], cycle[j] = cycle[j], cycle[i]
+	}
+	return cycle, true
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/icoolworld/trade/exchange"
+	"github.com/icoolworld/trade/journal"
+)
+
+// legPlan 描述三角套利里的一条腿：在哪个交易对上、往哪个方向下单，
+// 以及 forwardProfit/reverseProfit 模拟出来的扫单结果（计划吃掉多少、换回多少）
+type legPlan struct {
+	Symbol   string
+	Side     exchange.Side
+	InAsset  string // 这条腿花出去的币种
+	OutAsset string // 这条腿换回来的币种
+	plan     legResult
+}
+
+// runCycle 按状态机顺序把一次三角套利的三条腿真实发给 api：每条腿下单前后都先
+// 写一条日志再发请求，成交数量以交易所/撮合引擎实际返回的为准而不是模拟值，
+// 任何一条腿失败都会把已经成交的腿反向平掉（unwind），不会把仓位晾在半空中
+func (s *TriArbStrategy) runCycle(api exchange.SpotAPI, jr *journal.Journal, cycleID string, legs [3]legPlan) {
+	jr.Append(journal.Entry{CycleID: cycleID, Sequence: 0, State: journal.StatePlanned, Time: time.Now()})
+
+	sentStates := [3]journal.CycleState{journal.StateLeg1Sent, journal.StateLeg2Sent, journal.StateLeg3Sent}
+	filledStates := [3]journal.CycleState{journal.StateLeg1Filled, journal.StateLeg2Filled, journal.StateLeg3Filled}
+
+	for i, leg := range legs {
+		key := fmt.Sprintf("%s-leg%d", cycleID, i+1)
+		jr.Append(journal.Entry{
+			CycleID: cycleID, Sequence: i + 1, State: sentStates[i],
+			IdempotencyKey: key, Symbol: leg.Symbol, Side: string(leg.Side),
+			Quantity: leg.plan.filled, Time: time.Now(),
+		})
+
+		order, err := api.PlaceOrder(&exchange.OrderRequest{
+			Symbol:        leg.Symbol,
+			Side:          leg.Side,
+			Type:          exchange.OrderTypeMarket,
+			Quantity:      leg.plan.filled,
+			ClientOrderID: key,
+		})
+		if err != nil {
+			jr.Append(journal.Entry{
+				CycleID: cycleID, Sequence: i + 1, State: sentStates[i],
+				IdempotencyKey: key, Symbol: leg.Symbol, Side: string(leg.Side), Err: err.Error(), Time: time.Now(),
+			})
+			fmt.Printf("三角套利第%d腿下单失败（%s）：%v，开始回滚已经成交的腿\n", i+1, leg.Symbol, err)
+			s.unwind(api, jr, cycleID, legs[:i])
+			return
+		}
+
+		ratio := 1.0
+		if leg.plan.filled > 0 {
+			ratio = order.FilledQty / leg.plan.filled
+		}
+		actualOut := leg.plan.out * ratio
+		// order.FilledQty 永远是 base 数量：Sell 腿花出去的 InAsset 就是 base，直接扣；
+		// Buy 腿花出去的 InAsset 是 quote，实际花掉的是 FilledQty*vwap，不能直接拿 base 数量去扣
+		actualIn := order.FilledQty
+		if leg.Side == exchange.SideBuy {
+			actualIn = order.FilledQty * leg.plan.vwap
+		}
+		s.addBalance(leg.InAsset, -actualIn)
+		s.addBalance(leg.OutAsset, actualOut)
+
+		jr.Append(journal.Entry{
+			CycleID: cycleID, Sequence: i + 1, State: filledStates[i],
+			IdempotencyKey: key, Symbol: leg.Symbol, Side: string(leg.Side), OrderID: order.OrderID,
+			Quantity: leg.plan.filled, FilledQty: order.FilledQty, Time: time.Now(),
+		})
+
+		if order.FilledQty < leg.plan.filled {
+			// 没吃满计划的数量，后面的腿按计划量走会超过实际持仓，这里直接收手回滚。
+			// 回滚这条腿本身必须按真实成交的 order.FilledQty 算，不能用 leg.plan.filled，
+			// 否则会把只成交一部分的腿按全部计划量反向平仓，平多了留下一截净敞口
+			legs[i].plan.filled = order.FilledQty
+			fmt.Printf("三角套利第%d腿（%s）只成交了%.6f/%.6f，开始回滚已经成交的腿\n", i+1, leg.Symbol, order.FilledQty, leg.plan.filled)
+			s.unwind(api, jr, cycleID, legs[:i+1])
+			return
+		}
+	}
+
+	fmt.Printf("三角套利%s三条腿全部成交\n", cycleID)
+}
+
+// unwind 把已经成交的腿按相反方向平掉，尽量让仓位退回到这次三角套利开始之前的样子。
+// 只在某条腿失败或没吃满时触发，回滚本身用市价单立即执行，不再重新算一遍最优价格。
+// 反向下单的 Quantity 和 runCycle 下单时一样按 base 数量算（leg.plan.filled 不管原来这条
+// 腿是 Buy 还是 Sell 都是这条腿吃到的 base 数量），不能用只对 Buy 腿有意义的 leg.plan.out。
+// 调用方必须保证传进来的 leg.plan.filled 就是这条腿真实吃到的数量：对最后一条没吃满
+// 计划量的腿，调用方要先把 plan.filled 改写成 order.FilledQty，否则这里会按计划量
+// 而不是实际持仓去平仓，多平的部分留下一截没人管的净敞口。
+func (s *TriArbStrategy) unwind(api exchange.SpotAPI, jr *journal.Journal, cycleID string, done []legPlan) {
+	jr.Append(journal.Entry{CycleID: cycleID, Sequence: 0, State: journal.StateUnwinding, Time: time.Now()})
+
+	for i := len(done) - 1; i >= 0; i-- {
+		leg := done[i]
+		reverseSide := exchange.SideSell
+		if leg.Side == exchange.SideSell {
+			reverseSide = exchange.SideBuy
+		}
+		order, err := api.PlaceOrder(&exchange.OrderRequest{
+			Symbol:   leg.Symbol,
+			Side:     reverseSide,
+			Type:     exchange.OrderTypeMarket,
+			Quantity: leg.plan.filled,
+		})
+		if err != nil {
+			fmt.Printf("回滚第%d腿（%s）失败：%v，仓位需要人工核对\n", i+1, leg.Symbol, err)
+			jr.Append(journal.Entry{CycleID: cycleID, Sequence: i + 1, State: journal.StateUnwinding, Symbol: leg.Symbol, Err: err.Error(), Time: time.Now()})
+			continue
+		}
+		// 原来那条腿是 Sell 就花 InAsset 换了 OutAsset，回滚要用 OutAsset 买回 InAsset；
+		// 原来是 Buy 就反过来，按哪个币种是被花出去的哪个是被换回来的对称地记账
+		if leg.Side == exchange.SideSell {
+			s.addBalance(leg.InAsset, order.FilledQty)
+			s.addBalance(leg.OutAsset, -order.FilledQty*leg.plan.vwap)
+		} else {
+			s.addBalance(leg.OutAsset, -order.FilledQty)
+			s.addBalance(leg.InAsset, order.FilledQty*leg.plan.vwap)
+		}
+	}
+
+	jr.Append(journal.Entry{CycleID: cycleID, Sequence: 0, State: journal.StateUnwound, Time: time.Now()})
+}
+
+// addBalance 按币种名字给策略的持仓加上一个增量，FIL/ETH/BSV 是目前唯一支持的三个币种
+func (s *TriArbStrategy) addBalance(asset string, delta float64) {
+	switch asset {
+	case "FIL":
+		s.FilAmount += delta
+	case "ETH":
+		s.EthAmount += delta
+	case "BSV":
+		s.BsvAmount += delta
+	}
+}
+
+// reconcileJournal 在启动时回放日志，找出上次退出时还停在中间状态（没有 Terminal）
+// 的三角套利，向交易所查一下它最后一条腿的真实状态：有 OrderID 就按 OrderID 查，
+// 没有 OrderID 但留了 IdempotencyKey（PlaceOrder 发出去之后、写 LegNFilled 之前就崩溃
+// 的窗口）就按 ClientOrderID 查，两者都没有才能确定这条腿确实没发出去，直接按放弃处理；
+// 如果已经成交，按这条腿实际的 Sequence 补一条 LegNFilled 记录（不能不分青红皂白都标成
+// Leg3Filled，那样会把只走了一两条腿的半截三角当成顺利走完处理）。
+// 如果成交的不是第三条腿，说明后面的腿没机会再发了，这里没有保存足够的信息重新算出
+// 剩下两条腿该怎么走（journal.Entry 不记 InAsset/OutAsset 和另外两条腿的计划），
+// 能做的是把已经成交的这一条腿回滚掉，让仓位退回单一币种，而不是放着不管。
+// 回滚和正常下单一样会改 strategy 的币量，但这里用到的价格只是一个近似（订单本身不带
+// 成交均价，只能退而求其次用下单价或者当前盘口价），更准的持仓以 main 里随后调用一次
+// GetAccountBalance 刷新出来的真实余额为准。
+func reconcileJournal(path string, api exchange.SpotAPI, jr *journal.Journal, s *TriArbStrategy) {
+	entries, err := journal.Replay(path)
+	if err != nil {
+		fmt.Printf("回放交易日志失败：%v\n", err)
+		return
+	}
+
+	filledStates := [3]journal.CycleState{journal.StateLeg1Filled, journal.StateLeg2Filled, journal.StateLeg3Filled}
+
+	for cycleID, last := range journal.LastByCycle(entries) {
+		if last.State.Terminal() {
+			continue
+		}
+
+		var order *exchange.Order
+		if last.OrderID != "" {
+			order, err = api.GetOrder(last.Symbol, last.OrderID)
+		} else if last.IdempotencyKey != "" {
+			// LegNSent 记录是下单请求发出去之前写的，还没有 OrderID；如果进程恰好在
+			// PlaceOrder 返回之前（甚至订单已经在交易所成交之后）崩溃，日志里这笔腿就只有
+			// IdempotencyKey。这个键在下单时当成 ClientOrderID 一起发给了交易所，这里按
+			// 它去查，而不是直接当成没发出去处理，否则会把真实发生的成交当成从没发生过
+			order, err = api.GetOrderByClientID(last.Symbol, last.IdempotencyKey)
+		} else {
+			fmt.Printf("核对重启前的三角套利%s：第%d腿连幂等键都没留下就崩溃了，按放弃处理\n", cycleID, last.Sequence)
+			jr.Append(journal.Entry{CycleID: cycleID, Sequence: last.Sequence, State: journal.StateAbandoned, Time: time.Now()})
+			continue
+		}
+		if err != nil {
+			fmt.Printf("核对重启前的三角套利%s：第%d腿查询失败：%v，需要人工核对\n", cycleID, last.Sequence, err)
+			continue
+		}
+		if order.Status != "filled" && order.Status != "partially_filled" {
+			fmt.Printf("核对重启前的三角套利%s：第%d腿没有成交（状态=%s），按放弃处理\n", cycleID, last.Sequence, order.Status)
+			jr.Append(journal.Entry{CycleID: cycleID, Sequence: last.Sequence, State: journal.StateAbandoned, OrderID: order.OrderID, Time: time.Now()})
+			continue
+		}
+
+		fmt.Printf("核对重启前的三角套利%s：第%d腿实际成交了%.6f，标记为已成交\n", cycleID, last.Sequence, order.FilledQty)
+		jr.Append(journal.Entry{
+			CycleID: cycleID, Sequence: last.Sequence, State: filledStates[last.Sequence-1],
+			OrderID: order.OrderID, FilledQty: order.FilledQty, Time: time.Now(),
+		})
+
+		if last.Sequence == 3 {
+			// 三条腿都成交了，三角套利已经顺利走完，不需要回滚
+			continue
+		}
+
+		fmt.Printf("核对重启前的三角套利%s：只成交了%d/3条腿，回滚这一条腿，不把剩下的仓位晾在半空中\n", cycleID, last.Sequence)
+		side := exchange.Side(last.Side)
+		inAsset, outAsset := legAssets(last.Symbol, side)
+		vwap := order.Price
+		if vwap <= 0 {
+			if ticker, err := api.GetTicker(last.Symbol); err == nil {
+				vwap = ticker.Bid
+			}
+		}
+		s.unwind(api, jr, cycleID, []legPlan{{
+			Symbol: last.Symbol, Side: side, InAsset: inAsset, OutAsset: outAsset,
+			plan: legResult{filled: order.FilledQty, vwap: vwap},
+		}})
+	}
+}
+
+// legAssets 根据交易对符号和下单方向推出这条腿花出去（InAsset）、换回来（OutAsset）
+// 的币种，和 Execute 里手工拼 legPlan 用的是同一套约定：Sell 卖出 base 换 quote，
+// Buy 花 quote 买 base。reconcileJournal 核对日志时只留了 Symbol/Side，要靠这个
+// 推回 InAsset/OutAsset 才能调用 unwind。
+func legAssets(symbol string, side exchange.Side) (inAsset, outAsset string) {
+	base, quote, ok := splitSymbol(symbol)
+	if !ok {
+		return "", ""
+	}
+	if side == exchange.SideSell {
+		return base, quote
+	}
+	return quote, base
+}
+
+// splitSymbol 把 BASE-QUOTE 格式的交易对符号拆成两个币种
+func splitSymbol(symbol string) (base, quote string, ok bool) {
+	parts := strings.SplitN(symbol, "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/icoolworld/trade/exchange"
+	"github.com/icoolworld/trade/journal"
+)
+
+// reconcileTestAPI answers GetOrder/GetOrderByClientID/GetTicker with canned responses and
+// records PlaceOrder calls, so tests can drive reconcileJournal through a specific
+// restart scenario without touching a real exchange.
+type reconcileTestAPI struct {
+	fakeSpotAPI
+	order  *exchange.Order
+	ticker *exchange.Ticker
+}
+
+func (f *reconcileTestAPI) GetOrder(symbol, orderID string) (*exchange.Order, error) {
+	if f.order == nil {
+		return nil, errors.New("no order configured")
+	}
+	return f.order, nil
+}
+
+func (f *reconcileTestAPI) GetOrderByClientID(symbol, clientOrderID string) (*exchange.Order, error) {
+	if f.order == nil {
+		return nil, errors.New("no order configured")
+	}
+	return f.order, nil
+}
+
+func (f *reconcileTestAPI) GetTicker(symbol string) (*exchange.Ticker, error) {
+	if f.ticker == nil {
+		return nil, errors.New("no ticker configured")
+	}
+	return f.ticker, nil
+}
+
+// TestReconcileJournal_PartialCycleUnwindsLastFilledLeg covers the restart path where a
+// cycle crashed after only its first leg filled: the journal's last record for that cycle
+// is leg1_filled, not a terminal state. reconcileJournal must not mislabel this as
+// leg3_filled (the cycle never got that far) and must unwind the one confirmed leg instead
+// of leaving the strategy sitting on ETH with no plan to ever get back to FIL.
+func TestReconcileJournal_PartialCycleUnwindsLastFilledLeg(t *testing.T) {
+	path := t.TempDir() + "/trade.journal"
+	jr, err := journal.Open(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer jr.Close()
+
+	jr.Append(journal.Entry{CycleID: "c1", Sequence: 0, State: journal.StatePlanned})
+	jr.Append(journal.Entry{
+		CycleID: "c1", Sequence: 1, State: journal.StateLeg1Sent,
+		IdempotencyKey: "c1-leg1", Symbol: FIL_ETH, Side: string(exchange.SideSell), Quantity: 10,
+	})
+	jr.Append(journal.Entry{
+		CycleID: "c1", Sequence: 1, State: journal.StateLeg1Filled,
+		IdempotencyKey: "c1-leg1", Symbol: FIL_ETH, Side: string(exchange.SideSell),
+		OrderID: "o1", Quantity: 10, FilledQty: 10,
+	})
+
+	api := &reconcileTestAPI{
+		order:  &exchange.Order{OrderID: "o1", Symbol: FIL_ETH, Status: "filled", FilledQty: 10},
+		ticker: &exchange.Ticker{Symbol: FIL_ETH, Bid: 0.02, Ask: 0.021},
+	}
+
+	// reconcileJournal appends onto the same still-open journal a real restart would
+	// reuse (main opens it once per process); Replay reads the file independently.
+	s := &TriArbStrategy{}
+	reconcileJournal(path, api, jr, s)
+
+	if len(api.calls) != 1 {
+		t.Fatalf("expected one reverse order from unwind, got %d: %+v", len(api.calls), api.calls)
+	}
+	reverse := api.calls[0]
+	if reverse.Symbol != FIL_ETH || reverse.Side != exchange.SideBuy {
+		t.Fatalf("expected a FIL-ETH buy reversing the filled sell leg, got %s %s", reverse.Symbol, reverse.Side)
+	}
+	if reverse.Quantity != 10 {
+		t.Fatalf("expected reverse quantity 10 (base FIL), got %v", reverse.Quantity)
+	}
+
+	entries, err := journal.Replay(path)
+	if err != nil {
+		t.Fatalf("replay journal: %v", err)
+	}
+	last := journal.LastByCycle(entries)["c1"]
+	if last.State != journal.StateUnwound {
+		t.Fatalf("expected cycle to end up unwound, got state %q", last.State)
+	}
+}
+
+// TestReconcileJournal_FullyFilledCycleIsLeftAlone covers the case where the crash happened
+// right after the third leg's leg3_filled record was written (carrying the OrderID, just like
+// a real runCycle leaves it): leg3_filled is a terminal state, so reconcileJournal must leave
+// the cycle's last record as it is and must not try to unwind a cycle that already completed.
+func TestReconcileJournal_FullyFilledCycleIsLeftAlone(t *testing.T) {
+	path := t.TempDir() + "/trade.journal"
+	jr, err := journal.Open(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer jr.Close()
+
+	jr.Append(journal.Entry{
+		CycleID: "c2", Sequence: 3, State: journal.StateLeg3Filled,
+		IdempotencyKey: "c2-leg3", Symbol: FIL_BSV, Side: string(exchange.SideBuy),
+		OrderID: "o3", Quantity: 5, FilledQty: 5,
+	})
+
+	api := &reconcileTestAPI{
+		order: &exchange.Order{OrderID: "o3", Symbol: FIL_BSV, Status: "filled", FilledQty: 5},
+	}
+
+	s := &TriArbStrategy{}
+	reconcileJournal(path, api, jr, s)
+
+	if len(api.calls) != 0 {
+		t.Fatalf("expected no reverse orders for a fully filled cycle, got %+v", api.calls)
+	}
+
+	entries, err := journal.Replay(path)
+	if err != nil {
+		t.Fatalf("replay journal: %v", err)
+	}
+	last := journal.LastByCycle(entries)["c2"]
+	if last.State != journal.StateLeg3Filled {
+		t.Fatalf("expected leg3_filled, got %q", last.State)
+	}
+}
+
+// TestReconcileJournal_CrashBeforeFilledRecordUsesIdempotencyKey covers the exact window the
+// idempotency key exists for: runCycle writes LegNSent (no OrderID yet) before PlaceOrder
+// returns, so a crash between the order actually filling at the exchange and the LegNFilled
+// record being written leaves last.OrderID == "". reconcileJournal must query by the
+// IdempotencyKey it sent as ClientOrderID instead of defaulting to abandoned, or a real fill
+// gets silently dropped.
+func TestReconcileJournal_CrashBeforeFilledRecordUsesIdempotencyKey(t *testing.T) {
+	path := t.TempDir() + "/trade.journal"
+	jr, err := journal.Open(path)
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	defer jr.Close()
+
+	jr.Append(journal.Entry{
+		CycleID: "c3", Sequence: 1, State: journal.StateLeg1Sent,
+		IdempotencyKey: "c3-leg1", Symbol: FIL_ETH, Side: string(exchange.SideSell), Quantity: 10,
+	})
+
+	api := &reconcileTestAPI{
+		order:  &exchange.Order{OrderID: "o1", ClientOrderID: "c3-leg1", Symbol: FIL_ETH, Status: "filled", FilledQty: 10},
+		ticker: &exchange.Ticker{Symbol: FIL_ETH, Bid: 0.02, Ask: 0.021},
+	}
+
+	s := &TriArbStrategy{}
+	reconcileJournal(path, api, jr, s)
+
+	entries, err := journal.Replay(path)
+	if err != nil {
+		t.Fatalf("replay journal: %v", err)
+	}
+	last := journal.LastByCycle(entries)["c3"]
+	if last.State != journal.StateUnwound {
+		t.Fatalf("expected the confirmed fill to be recognized and unwound, got state %q", last.State)
+	}
+	if len(api.calls) != 1 || api.calls[0].Symbol != FIL_ETH || api.calls[0].Side != exchange.SideBuy {
+		t.Fatalf("expected one reverse order for the recovered fill, got %+v", api.calls)
+	}
+}
@@ -0,0 +1,465 @@
+package exchange
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	binanceRestBaseURL = "https://api.binance.com"
+	binanceWsBaseURL   = "wss://stream.binance.com:9443/ws"
+)
+
+// BinanceClient 实现了针对币安现货的 SpotAPI 和 WsAPI
+type BinanceClient struct {
+	apiKey    string
+	apiSecret string
+	client    *http.Client
+
+	limiter *rateLimiter
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+	done  chan struct{} // Close 后关闭，subscribe 的重连循环靠它停下来
+}
+
+// NewBinanceClient 创建一个币安现货客户端，apiKey/apiSecret 为空时只能调用公共接口
+func NewBinanceClient(apiKey, apiSecret string) *BinanceClient {
+	return &BinanceClient{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		limiter:   newRateLimiter(10, time.Second), // 币安权重限制，保守取每秒10次请求
+		done:      make(chan struct{}),
+	}
+}
+
+// toBinanceSymbol 把统一的 BASE-QUOTE 符号转成币安的 BASEQUOTE 格式，例如 FIL-ETH -> FILETH
+func toBinanceSymbol(symbol string) string {
+	return strings.ReplaceAll(strings.ToUpper(symbol), "-", "")
+}
+
+func (c *BinanceClient) sign(query string) string {
+	mac := hmac.New(sha256.New, []byte(c.apiSecret))
+	mac.Write([]byte(query))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *BinanceClient) doSigned(method, path string, params url.Values) ([]byte, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	params.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	query := params.Encode()
+	query += "&signature=" + c.sign(query)
+
+	req, err := http.NewRequest(method, binanceRestBaseURL+path+"?"+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-MBX-APIKEY", c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("binance: %s %s returned %d: %s", method, path, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (c *BinanceClient) GetAllCurrencyPair() ([]string, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get(binanceRestBaseURL + "/api/v3/exchangeInfo")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		Symbols []struct {
+			Symbol string `json:"symbol"`
+		} `json:"symbols"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	pairs := make([]string, 0, len(info.Symbols))
+	for _, s := range info.Symbols {
+		pairs = append(pairs, s.Symbol)
+	}
+	return pairs, nil
+}
+
+func (c *BinanceClient) GetTicker(symbol string) (*Ticker, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get(binanceRestBaseURL + "/api/v3/ticker/bookTicker?symbol=" + toBinanceSymbol(symbol))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		BidPrice string `json:"bidPrice"`
+		BidQty   string `json:"bidQty"`
+		AskPrice string `json:"askPrice"`
+		AskQty   string `json:"askQty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return &Ticker{
+		Symbol: symbol,
+		Bid:    parseFloat(raw.BidPrice),
+		BidQty: parseFloat(raw.BidQty),
+		Ask:    parseFloat(raw.AskPrice),
+		AskQty: parseFloat(raw.AskQty),
+		Time:   time.Now(),
+	}, nil
+}
+
+func (c *BinanceClient) GetDepth(symbol string, limit int) (*Depth, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/v3/depth?symbol=%s&limit=%d", binanceRestBaseURL, toBinanceSymbol(symbol), limit)
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		LastUpdateID int64       `json:"lastUpdateId"`
+		Bids         [][2]string `json:"bids"`
+		Asks         [][2]string `json:"asks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	return &Depth{
+		Symbol:       symbol,
+		Bids:         toLevels(raw.Bids),
+		Asks:         toLevels(raw.Asks),
+		LastUpdateID: raw.LastUpdateID,
+		Time:         time.Now(),
+	}, nil
+}
+
+func (c *BinanceClient) PlaceOrder(req *OrderRequest) (*Order, error) {
+	params := url.Values{}
+	params.Set("symbol", toBinanceSymbol(req.Symbol))
+	if req.Side == SideBuy {
+		params.Set("side", "BUY")
+	} else {
+		params.Set("side", "SELL")
+	}
+	if req.Type == OrderTypeMarket {
+		params.Set("type", "MARKET")
+	} else {
+		params.Set("type", "LIMIT")
+		params.Set("timeInForce", "GTC")
+		params.Set("price", strconv.FormatFloat(req.Price, 'f', -1, 64))
+	}
+	params.Set("quantity", strconv.FormatFloat(req.Quantity, 'f', -1, 64))
+	if req.ClientOrderID != "" {
+		params.Set("newClientOrderId", req.ClientOrderID)
+	}
+
+	body, err := c.doSigned(http.MethodPost, "/api/v3/order", params)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		OrderID       int64  `json:"orderId"`
+		ClientOrderID string `json:"clientOrderId"`
+		Status        string `json:"status"`
+		ExecutedQty   string `json:"executedQty"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	return &Order{
+		OrderID:       strconv.FormatInt(raw.OrderID, 10),
+		ClientOrderID: raw.ClientOrderID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		FilledQty:     parseFloat(raw.ExecutedQty),
+		Status:        strings.ToLower(raw.Status),
+	}, nil
+}
+
+func (c *BinanceClient) GetOrder(symbol, orderID string) (*Order, error) {
+	params := url.Values{}
+	params.Set("symbol", toBinanceSymbol(symbol))
+	params.Set("orderId", orderID)
+	return c.getOrder(symbol, params)
+}
+
+// GetOrderByClientID 按下单时带的 newClientOrderId 查询订单，用 Binance 对应的查询参数
+// origClientOrderId。用于重启后日志里连 OrderID 都没记下来的场景
+func (c *BinanceClient) GetOrderByClientID(symbol, clientOrderID string) (*Order, error) {
+	params := url.Values{}
+	params.Set("symbol", toBinanceSymbol(symbol))
+	params.Set("origClientOrderId", clientOrderID)
+	return c.getOrder(symbol, params)
+}
+
+func (c *BinanceClient) getOrder(symbol string, params url.Values) (*Order, error) {
+	body, err := c.doSigned(http.MethodGet, "/api/v3/order", params)
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		OrderID       int64  `json:"orderId"`
+		ClientOrderID string `json:"clientOrderId"`
+		Price         string `json:"price"`
+		OrigQty       string `json:"origQty"`
+		ExecutedQty   string `json:"executedQty"`
+		Side          string `json:"side"`
+		Status        string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	side := SideBuy
+	if raw.Side == "SELL" {
+		side = SideSell
+	}
+	return &Order{
+		OrderID:       strconv.FormatInt(raw.OrderID, 10),
+		ClientOrderID: raw.ClientOrderID,
+		Symbol:        symbol,
+		Side:          side,
+		Price:         parseFloat(raw.Price),
+		Quantity:      parseFloat(raw.OrigQty),
+		FilledQty:     parseFloat(raw.ExecutedQty),
+		Status:        strings.ToLower(raw.Status),
+	}, nil
+}
+
+func (c *BinanceClient) CancelOrder(symbol, orderID string) error {
+	params := url.Values{}
+	params.Set("symbol", toBinanceSymbol(symbol))
+	params.Set("orderId", orderID)
+	_, err := c.doSigned(http.MethodDelete, "/api/v3/order", params)
+	return err
+}
+
+func (c *BinanceClient) GetAccountBalance() (map[string]float64, error) {
+	body, err := c.doSigned(http.MethodGet, "/api/v3/account", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	var raw struct {
+		Balances []struct {
+			Asset string `json:"asset"`
+			Free  string `json:"free"`
+		} `json:"balances"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(raw.Balances))
+	for _, b := range raw.Balances {
+		balances[b.Asset] = parseFloat(b.Free)
+	}
+	return balances, nil
+}
+
+// subscribe 建立一条币安 websocket 连接，断线后按指数退避自动重连，并通过 ping/pong 维持心跳：
+// 每 20 秒主动发一个 ping 控制帧，SetPongHandler 收到对应的 pong 后把读超时往后推，读超时
+// 初始就设好，连接半开（对方不再回 pong）时 ReadMessage 会按时超时返回而不是一直挂着。
+// 重连循环在每次重新拨号前、以及退避等待和读取出错之后都会检查 c.done，Close 关闭这个
+// channel 后循环会在当前这一轮结束后退出，不会再继续重连、也不会再往 c.conns 里追加连接。
+func (c *BinanceClient) subscribe(stream string, handle func(message []byte)) error {
+	backoff := time.Second
+	go func() {
+		for {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+
+			conn, _, err := websocket.DefaultDialer.Dial(binanceWsBaseURL+"/"+stream, nil)
+			if err != nil {
+				select {
+				case <-c.done:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = minDuration(backoff*2, 30*time.Second)
+				continue
+			}
+			backoff = time.Second
+			c.mu.Lock()
+			c.conns = append(c.conns, conn)
+			c.mu.Unlock()
+
+			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			})
+
+			stopHeartbeat := make(chan struct{})
+			go func() {
+				ticker := time.NewTicker(20 * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second))
+					case <-stopHeartbeat:
+						return
+					}
+				}
+			}()
+
+			for {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					close(stopHeartbeat)
+					conn.Close()
+					break
+				}
+				handle(message)
+			}
+
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *BinanceClient) SubscribeTicker(symbol string, ch chan<- *Ticker) error {
+	stream := strings.ToLower(toBinanceSymbol(symbol)) + "@bookTicker"
+	return c.subscribe(stream, func(message []byte) {
+		var raw struct {
+			BidPrice string `json:"b"`
+			BidQty   string `json:"B"`
+			AskPrice string `json:"a"`
+			AskQty   string `json:"A"`
+		}
+		if err := json.Unmarshal(message, &raw); err != nil {
+			return
+		}
+		ch <- &Ticker{
+			Symbol: symbol,
+			Bid:    parseFloat(raw.BidPrice),
+			BidQty: parseFloat(raw.BidQty),
+			Ask:    parseFloat(raw.AskPrice),
+			AskQty: parseFloat(raw.AskQty),
+			Time:   time.Now(),
+		}
+	})
+}
+
+func (c *BinanceClient) SubscribeDepth(symbol string, ch chan<- *Depth) error {
+	stream := strings.ToLower(toBinanceSymbol(symbol)) + "@depth20@100ms"
+	return c.subscribe(stream, func(message []byte) {
+		var raw struct {
+			Bids [][2]string `json:"bids"`
+			Asks [][2]string `json:"asks"`
+		}
+		if err := json.Unmarshal(message, &raw); err != nil {
+			return
+		}
+		ch <- &Depth{
+			Symbol: symbol,
+			Bids:   toLevels(raw.Bids),
+			Asks:   toLevels(raw.Asks),
+			Time:   time.Now(),
+		}
+	})
+}
+
+func (c *BinanceClient) SubscribeTrades(symbol string, ch chan<- *Trade) error {
+	stream := strings.ToLower(toBinanceSymbol(symbol)) + "@trade"
+	return c.subscribe(stream, func(message []byte) {
+		var raw struct {
+			Price        string `json:"p"`
+			Qty          string `json:"q"`
+			IsBuyerMaker bool   `json:"m"`
+		}
+		if err := json.Unmarshal(message, &raw); err != nil {
+			return
+		}
+		side := SideBuy
+		if raw.IsBuyerMaker {
+			side = SideSell
+		}
+		ch <- &Trade{
+			Symbol: symbol,
+			Price:  parseFloat(raw.Price),
+			Qty:    parseFloat(raw.Qty),
+			Side:   side,
+			Time:   time.Now(),
+		}
+	})
+}
+
+func (c *BinanceClient) SubscribeDepthUpdate(symbol string, ch chan<- *DepthUpdate) error {
+	stream := strings.ToLower(toBinanceSymbol(symbol)) + "@depth"
+	return c.subscribe(stream, func(message []byte) {
+		var raw struct {
+			FirstUpdateID int64       `json:"U"`
+			FinalUpdateID int64       `json:"u"`
+			Bids          [][2]string `json:"b"`
+			Asks          [][2]string `json:"a"`
+		}
+		if err := json.Unmarshal(message, &raw); err != nil {
+			return
+		}
+		ch <- &DepthUpdate{
+			Symbol:        symbol,
+			FirstUpdateID: raw.FirstUpdateID,
+			FinalUpdateID: raw.FinalUpdateID,
+			Bids:          toLevels(raw.Bids),
+			Asks:          toLevels(raw.Asks),
+		}
+	})
+}
+
+func (c *BinanceClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+	return nil
+}
@@ -0,0 +1,553 @@
+package exchange
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	huobiRestHost = "api.huobi.pro"
+	huobiWsURL    = "wss://api.huobi.pro/ws"
+)
+
+// HuobiClient 实现了针对火币现货的 SpotAPI 和 WsAPI
+type HuobiClient struct {
+	accessKey string
+	secretKey string
+	client    *http.Client
+	limiter   *rateLimiter
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+	done  chan struct{} // Close 后关闭，subscribe 的重连循环靠它停下来
+}
+
+func NewHuobiClient(accessKey, secretKey string) *HuobiClient {
+	return &HuobiClient{
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		limiter:   newRateLimiter(10, time.Second),
+		done:      make(chan struct{}),
+	}
+}
+
+// toHuobiSymbol 把统一的 BASE-QUOTE 符号转成火币的全小写无分隔符格式，例如 FIL-ETH -> fileth
+func toHuobiSymbol(symbol string) string {
+	return strings.ToLower(strings.ReplaceAll(symbol, "-", ""))
+}
+
+// sign 按火币 Signature V2 的规则构造待签名字符串并做 HMAC-SHA256 + base64
+func (c *HuobiClient) sign(method, path string, params url.Values) string {
+	params.Set("AccessKeyId", c.accessKey)
+	params.Set("SignatureMethod", "HmacSHA256")
+	params.Set("SignatureVersion", "2")
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05"))
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(params.Get(k)))
+	}
+	query := strings.Join(pairs, "&")
+	payload := method + "\n" + huobiRestHost + "\n" + path + "\n" + query
+
+	mac := hmac.New(sha256.New, []byte(c.secretKey))
+	mac.Write([]byte(payload))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	params.Set("Signature", signature)
+	return query + "&Signature=" + url.QueryEscape(signature)
+}
+
+func (c *HuobiClient) doSigned(method, path string, params url.Values, body interface{}) ([]byte, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	query := c.sign(method, path, params)
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, "https://"+huobiRestHost+path+"?"+query, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("huobi: %s %s returned %d: %s", method, path, resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+func (c *HuobiClient) GetAllCurrencyPair() ([]string, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get("https://" + huobiRestHost + "/v1/common/symbols")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env struct {
+		Data []struct {
+			Symbol string `json:"symbol"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	pairs := make([]string, 0, len(env.Data))
+	for _, s := range env.Data {
+		pairs = append(pairs, s.Symbol)
+	}
+	return pairs, nil
+}
+
+func (c *HuobiClient) GetTicker(symbol string) (*Ticker, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get("https://" + huobiRestHost + "/market/detail/merged?symbol=" + toHuobiSymbol(symbol))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env struct {
+		Tick struct {
+			Bid []float64 `json:"bid"`
+			Ask []float64 `json:"ask"`
+		} `json:"tick"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	if len(env.Tick.Bid) < 2 || len(env.Tick.Ask) < 2 {
+		return nil, fmt.Errorf("huobi: malformed ticker for %s", symbol)
+	}
+	return &Ticker{
+		Symbol: symbol,
+		Bid:    env.Tick.Bid[0],
+		BidQty: env.Tick.Bid[1],
+		Ask:    env.Tick.Ask[0],
+		AskQty: env.Tick.Ask[1],
+		Time:   time.Now(),
+	}, nil
+}
+
+func (c *HuobiClient) GetDepth(symbol string, limit int) (*Depth, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	depthType := depthTypeForLimit(limit)
+	resp, err := c.client.Get(fmt.Sprintf("https://%s/market/depth?symbol=%s&type=%s", huobiRestHost, toHuobiSymbol(symbol), depthType))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env struct {
+		Tick struct {
+			Bids    [][2]float64 `json:"bids"`
+			Asks    [][2]float64 `json:"asks"`
+			Version int64        `json:"version"`
+		} `json:"tick"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	return &Depth{
+		Symbol:       symbol,
+		Bids:         toLevelsFloat(env.Tick.Bids),
+		Asks:         toLevelsFloat(env.Tick.Asks),
+		LastUpdateID: env.Tick.Version,
+		Time:         time.Now(),
+	}, nil
+}
+
+// depthTypeForLimit 把请求的档位数映射到火币固定的几档深度类型（step0 最细）
+func depthTypeForLimit(limit int) string {
+	if limit <= 20 {
+		return "step0"
+	}
+	return "step1"
+}
+
+func toLevelsFloat(raw [][2]float64) []DepthLevel {
+	levels := make([]DepthLevel, 0, len(raw))
+	for _, row := range raw {
+		levels = append(levels, DepthLevel{Price: row[0], Qty: row[1]})
+	}
+	return levels
+}
+
+func (c *HuobiClient) PlaceOrder(req *OrderRequest) (*Order, error) {
+	accountID, err := c.spotAccountID()
+	if err != nil {
+		return nil, err
+	}
+	orderType := "buy-limit"
+	if req.Side == SideSell {
+		orderType = "sell-limit"
+	}
+	if req.Type == OrderTypeMarket {
+		orderType = strings.Replace(orderType, "limit", "market", 1)
+	}
+	body := map[string]string{
+		"account-id": accountID,
+		"symbol":     toHuobiSymbol(req.Symbol),
+		"type":       orderType,
+		"amount":     strconv.FormatFloat(req.Quantity, 'f', -1, 64),
+		"price":      strconv.FormatFloat(req.Price, 'f', -1, 64),
+		"source":     "spot-api",
+	}
+	if req.ClientOrderID != "" {
+		body["client-order-id"] = req.ClientOrderID
+	}
+	respBody, err := c.doSigned(http.MethodPost, "/v1/order/orders/place", url.Values{}, body)
+	if err != nil {
+		return nil, err
+	}
+	var env struct {
+		Data string `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return nil, err
+	}
+	return &Order{
+		OrderID:       env.Data,
+		ClientOrderID: req.ClientOrderID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		Status:        "new",
+	}, nil
+}
+
+// spotAccountID 查询现货账户 ID，下单接口需要携带
+func (c *HuobiClient) spotAccountID() (string, error) {
+	respBody, err := c.doSigned(http.MethodGet, "/v1/account/accounts", url.Values{}, nil)
+	if err != nil {
+		return "", err
+	}
+	var env struct {
+		Data []struct {
+			ID   int64  `json:"id"`
+			Type string `json:"type"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return "", err
+	}
+	for _, a := range env.Data {
+		if a.Type == "spot" {
+			return strconv.FormatInt(a.ID, 10), nil
+		}
+	}
+	return "", fmt.Errorf("huobi: no spot account found")
+}
+
+func (c *HuobiClient) GetOrder(symbol, orderID string) (*Order, error) {
+	return c.getOrder(symbol, "/v1/order/orders/"+orderID, url.Values{})
+}
+
+// GetOrderByClientID 按下单时带的 client-order-id 查询订单，用 Huobi 对应的查询接口
+// /v1/order/orders/getClientOrder。用于重启后日志里连 OrderID 都没记下来的场景
+func (c *HuobiClient) GetOrderByClientID(symbol, clientOrderID string) (*Order, error) {
+	params := url.Values{}
+	params.Set("clientOrderId", clientOrderID)
+	return c.getOrder(symbol, "/v1/order/orders/getClientOrder", params)
+}
+
+func (c *HuobiClient) getOrder(symbol, path string, params url.Values) (*Order, error) {
+	respBody, err := c.doSigned(http.MethodGet, path, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	var env struct {
+		Data struct {
+			ID            int64  `json:"id"`
+			ClientOrderID string `json:"client-order-id"`
+			Price         string `json:"price"`
+			Amount        string `json:"amount"`
+			FieldAmount   string `json:"field-amount"`
+			Type          string `json:"type"`
+			State         string `json:"state"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return nil, err
+	}
+	side := SideBuy
+	if strings.HasPrefix(env.Data.Type, "sell") {
+		side = SideSell
+	}
+	status := env.Data.State
+	switch status {
+	case "created", "submitted":
+		status = "new"
+	case "partial-filled":
+		status = "partially_filled"
+	case "partial-canceled":
+		status = "canceled"
+	}
+	return &Order{
+		OrderID:       strconv.FormatInt(env.Data.ID, 10),
+		ClientOrderID: env.Data.ClientOrderID,
+		Symbol:        symbol,
+		Side:          side,
+		Price:         parseFloat(env.Data.Price),
+		Quantity:      parseFloat(env.Data.Amount),
+		FilledQty:     parseFloat(env.Data.FieldAmount),
+		Status:        status,
+	}, nil
+}
+
+func (c *HuobiClient) CancelOrder(symbol, orderID string) error {
+	_, err := c.doSigned(http.MethodPost, "/v1/order/orders/"+orderID+"/submitcancel", url.Values{}, nil)
+	return err
+}
+
+func (c *HuobiClient) GetAccountBalance() (map[string]float64, error) {
+	accountID, err := c.spotAccountID()
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := c.doSigned(http.MethodGet, "/v1/account/accounts/"+accountID+"/balance", url.Values{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var env struct {
+		Data struct {
+			List []struct {
+				Currency string `json:"currency"`
+				Type     string `json:"type"`
+				Balance  string `json:"balance"`
+			} `json:"list"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64)
+	for _, item := range env.Data.List {
+		if item.Type == "trade" {
+			balances[item.Currency] += parseFloat(item.Balance)
+		}
+	}
+	return balances, nil
+}
+
+// subscribe 建立一条火币 websocket 连接，消息经 gzip 压缩，需要对服务端的 ping 回复 pong 维持心跳。
+// 重连循环在每次重新拨号前、以及退避等待和读取出错之后都会检查 c.done，Close 关闭这个
+// channel 后循环会在当前这一轮结束后退出，不会再继续重连、也不会再往 c.conns 里追加连接。
+func (c *HuobiClient) subscribe(topic string, handle func(message []byte)) error {
+	backoff := time.Second
+	go func() {
+		for {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+
+			conn, _, err := websocket.DefaultDialer.Dial(huobiWsURL, nil)
+			if err != nil {
+				select {
+				case <-c.done:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = minDuration(backoff*2, 30*time.Second)
+				continue
+			}
+			backoff = time.Second
+			c.mu.Lock()
+			c.conns = append(c.conns, conn)
+			c.mu.Unlock()
+
+			sub, _ := json.Marshal(map[string]string{"sub": topic, "id": "tri-arb"})
+			if err := conn.WriteMessage(websocket.TextMessage, sub); err != nil {
+				conn.Close()
+				continue
+			}
+
+			for {
+				_, raw, err := conn.ReadMessage()
+				if err != nil {
+					conn.Close()
+					break
+				}
+				reader, err := gzip.NewReader(bytes.NewReader(raw))
+				if err != nil {
+					continue
+				}
+				message, err := io.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					continue
+				}
+
+				var ping struct {
+					Ping int64 `json:"ping"`
+				}
+				if json.Unmarshal(message, &ping) == nil && ping.Ping != 0 {
+					pong, _ := json.Marshal(map[string]int64{"pong": ping.Ping})
+					conn.WriteMessage(websocket.TextMessage, pong)
+					continue
+				}
+				handle(message)
+			}
+
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *HuobiClient) SubscribeTicker(symbol string, ch chan<- *Ticker) error {
+	return c.subscribe("market."+toHuobiSymbol(symbol)+".bbo", func(message []byte) {
+		var env struct {
+			Tick struct {
+				Bid     float64 `json:"bid"`
+				BidSize float64 `json:"bidSize"`
+				Ask     float64 `json:"ask"`
+				AskSize float64 `json:"askSize"`
+			} `json:"tick"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil {
+			return
+		}
+		ch <- &Ticker{
+			Symbol: symbol,
+			Bid:    env.Tick.Bid,
+			BidQty: env.Tick.BidSize,
+			Ask:    env.Tick.Ask,
+			AskQty: env.Tick.AskSize,
+			Time:   time.Now(),
+		}
+	})
+}
+
+func (c *HuobiClient) SubscribeDepth(symbol string, ch chan<- *Depth) error {
+	return c.subscribe("market."+toHuobiSymbol(symbol)+".depth.step0", func(message []byte) {
+		var env struct {
+			Tick struct {
+				Bids [][2]float64 `json:"bids"`
+				Asks [][2]float64 `json:"asks"`
+			} `json:"tick"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil {
+			return
+		}
+		ch <- &Depth{
+			Symbol: symbol,
+			Bids:   toLevelsFloat(env.Tick.Bids),
+			Asks:   toLevelsFloat(env.Tick.Asks),
+			Time:   time.Now(),
+		}
+	})
+}
+
+func (c *HuobiClient) SubscribeTrades(symbol string, ch chan<- *Trade) error {
+	return c.subscribe("market."+toHuobiSymbol(symbol)+".trade.detail", func(message []byte) {
+		var env struct {
+			Tick struct {
+				Data []struct {
+					Price     float64 `json:"price"`
+					Amount    float64 `json:"amount"`
+					Direction string  `json:"direction"`
+				} `json:"data"`
+			} `json:"tick"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil || len(env.Tick.Data) == 0 {
+			return
+		}
+		for _, t := range env.Tick.Data {
+			side := SideBuy
+			if t.Direction == "sell" {
+				side = SideSell
+			}
+			ch <- &Trade{Symbol: symbol, Price: t.Price, Qty: t.Amount, Side: side, Time: time.Now()}
+		}
+	})
+}
+
+func (c *HuobiClient) SubscribeDepthUpdate(symbol string, ch chan<- *DepthUpdate) error {
+	return c.subscribe("market."+toHuobiSymbol(symbol)+".mbp.150", func(message []byte) {
+		var env struct {
+			Tick struct {
+				SeqNum     int64        `json:"seqNum"`
+				PrevSeqNum int64        `json:"prevSeqNum"`
+				Bids       [][2]float64 `json:"bids"`
+				Asks       [][2]float64 `json:"asks"`
+			} `json:"tick"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil {
+			return
+		}
+		ch <- &DepthUpdate{
+			Symbol:        symbol,
+			FirstUpdateID: env.Tick.PrevSeqNum + 1,
+			FinalUpdateID: env.Tick.SeqNum,
+			Bids:          toLevelsFloat(env.Tick.Bids),
+			Asks:          toLevelsFloat(env.Tick.Asks),
+		}
+	})
+}
+
+func (c *HuobiClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+	return nil
+}
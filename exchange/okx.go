@@ -0,0 +1,519 @@
+package exchange
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	okxRestBaseURL  = "https://www.okx.com"
+	okxWsPublicURL  = "wss://ws.okx.com:8443/ws/v5/public"
+	okxWsPrivateURL = "wss://ws.okx.com:8443/ws/v5/private"
+)
+
+// OKXClient 实现了针对 OKX 现货的 SpotAPI 和 WsAPI
+type OKXClient struct {
+	apiKey     string
+	apiSecret  string
+	passphrase string
+	client     *http.Client
+	limiter    *rateLimiter
+
+	mu    sync.Mutex
+	conns []*websocket.Conn
+	done  chan struct{} // Close 后关闭，subscribe 的重连循环靠它停下来
+}
+
+func NewOKXClient(apiKey, apiSecret, passphrase string) *OKXClient {
+	return &OKXClient{
+		apiKey:     apiKey,
+		apiSecret:  apiSecret,
+		passphrase: passphrase,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		limiter:    newRateLimiter(20, time.Second),
+		done:       make(chan struct{}),
+	}
+}
+
+// toOKXSymbol 把统一的 BASE-QUOTE 符号转成 OKX 的 BASE-QUOTE 大写格式，两者恰好一致
+func toOKXSymbol(symbol string) string {
+	return strings.ToUpper(symbol)
+}
+
+// sign 按 OKX 的签名规则对 timestamp+method+path+body 做 HMAC-SHA256 后 base64 编码
+func (c *OKXClient) sign(timestamp, method, path, body string) string {
+	mac := hmac.New(sha256.New, []byte(c.apiSecret))
+	mac.Write([]byte(timestamp + method + path + body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *OKXClient) doSigned(method, path, body string) ([]byte, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+
+	req, err := http.NewRequest(method, okxRestBaseURL+path, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("OK-ACCESS-KEY", c.apiKey)
+	req.Header.Set("OK-ACCESS-SIGN", c.sign(timestamp, method, path, body))
+	req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+	req.Header.Set("OK-ACCESS-PASSPHRASE", c.passphrase)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("okx: %s %s returned %d: %s", method, path, resp.StatusCode, respBody)
+	}
+	return respBody, nil
+}
+
+type okxEnvelope struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (c *OKXClient) GetAllCurrencyPair() ([]string, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get(okxRestBaseURL + "/api/v5/public/instruments?instType=SPOT")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env okxEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	var instruments []struct {
+		InstID string `json:"instId"`
+	}
+	if err := json.Unmarshal(env.Data, &instruments); err != nil {
+		return nil, err
+	}
+	pairs := make([]string, 0, len(instruments))
+	for _, i := range instruments {
+		pairs = append(pairs, i.InstID)
+	}
+	return pairs, nil
+}
+
+func (c *OKXClient) GetTicker(symbol string) (*Ticker, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Get(okxRestBaseURL + "/api/v5/market/ticker?instId=" + toOKXSymbol(symbol))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env okxEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		BidPx string `json:"bidPx"`
+		BidSz string `json:"bidSz"`
+		AskPx string `json:"askPx"`
+		AskSz string `json:"askSz"`
+	}
+	if err := json.Unmarshal(env.Data, &rows); err != nil || len(rows) == 0 {
+		return nil, fmt.Errorf("okx: empty ticker for %s", symbol)
+	}
+	row := rows[0]
+	return &Ticker{
+		Symbol: symbol,
+		Bid:    parseFloat(row.BidPx),
+		BidQty: parseFloat(row.BidSz),
+		Ask:    parseFloat(row.AskPx),
+		AskQty: parseFloat(row.AskSz),
+		Time:   time.Now(),
+	}, nil
+}
+
+func (c *OKXClient) GetDepth(symbol string, limit int) (*Depth, error) {
+	if err := c.limiter.Wait(); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/v5/market/books?instId=%s&sz=%d", okxRestBaseURL, toOKXSymbol(symbol), limit)
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var env okxEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Bids  [][4]string `json:"bids"`
+		Asks  [][4]string `json:"asks"`
+		SeqID int64       `json:"seqId"`
+	}
+	if err := json.Unmarshal(env.Data, &rows); err != nil || len(rows) == 0 {
+		return nil, fmt.Errorf("okx: empty depth for %s", symbol)
+	}
+	return &Depth{
+		Symbol:       symbol,
+		Bids:         toLevels4(rows[0].Bids),
+		Asks:         toLevels4(rows[0].Asks),
+		LastUpdateID: rows[0].SeqID,
+		Time:         time.Now(),
+	}, nil
+}
+
+// toLevels4 和 toLevels 类似，但 OKX 的深度档位是 [价格, 数量, 废弃字段, 订单数] 四元组
+func toLevels4(raw [][4]string) []DepthLevel {
+	levels := make([]DepthLevel, 0, len(raw))
+	for _, row := range raw {
+		levels = append(levels, DepthLevel{Price: parseFloat(row[0]), Qty: parseFloat(row[1])})
+	}
+	return levels
+}
+
+func (c *OKXClient) PlaceOrder(req *OrderRequest) (*Order, error) {
+	side := "buy"
+	if req.Side == SideSell {
+		side = "sell"
+	}
+	ordType := "limit"
+	if req.Type == OrderTypeMarket {
+		ordType = "market"
+	}
+	payload := map[string]string{
+		"instId":  toOKXSymbol(req.Symbol),
+		"tdMode":  "cash",
+		"side":    side,
+		"ordType": ordType,
+		"sz":      fmt.Sprintf("%v", req.Quantity),
+		"px":      fmt.Sprintf("%v", req.Price),
+	}
+	if req.ClientOrderID != "" {
+		payload["clOrdId"] = req.ClientOrderID
+	}
+	body, _ := json.Marshal(payload)
+
+	respBody, err := c.doSigned(http.MethodPost, "/api/v5/trade/order", string(body))
+	if err != nil {
+		return nil, err
+	}
+	var env okxEnvelope
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		OrdID   string `json:"ordId"`
+		ClOrdID string `json:"clOrdId"`
+		SCode   string `json:"sCode"`
+	}
+	if err := json.Unmarshal(env.Data, &rows); err != nil || len(rows) == 0 {
+		return nil, fmt.Errorf("okx: place order failed: %s", env.Msg)
+	}
+	return &Order{
+		OrderID:       rows[0].OrdID,
+		ClientOrderID: rows[0].ClOrdID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		Status:        "new",
+	}, nil
+}
+
+func (c *OKXClient) GetOrder(symbol, orderID string) (*Order, error) {
+	path := fmt.Sprintf("/api/v5/trade/order?instId=%s&ordId=%s", toOKXSymbol(symbol), orderID)
+	return c.getOrder(symbol, path)
+}
+
+// GetOrderByClientID 按下单时带的 clOrdId 查询订单。用于重启后日志里连 OrderID
+// 都没记下来的场景
+func (c *OKXClient) GetOrderByClientID(symbol, clientOrderID string) (*Order, error) {
+	path := fmt.Sprintf("/api/v5/trade/order?instId=%s&clOrdId=%s", toOKXSymbol(symbol), clientOrderID)
+	return c.getOrder(symbol, path)
+}
+
+func (c *OKXClient) getOrder(symbol, path string) (*Order, error) {
+	respBody, err := c.doSigned(http.MethodGet, path, "")
+	if err != nil {
+		return nil, err
+	}
+	var env okxEnvelope
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		OrdID   string `json:"ordId"`
+		ClOrdID string `json:"clOrdId"`
+		Px      string `json:"px"`
+		Sz      string `json:"sz"`
+		Side    string `json:"side"`
+		FillSz  string `json:"accFillSz"`
+		State   string `json:"state"`
+	}
+	if err := json.Unmarshal(env.Data, &rows); err != nil || len(rows) == 0 {
+		return nil, fmt.Errorf("okx: get order failed: %s", env.Msg)
+	}
+	row := rows[0]
+	side := SideBuy
+	if row.Side == "sell" {
+		side = SideSell
+	}
+	status := row.State
+	if status == "live" {
+		status = "new"
+	}
+	return &Order{
+		OrderID:       row.OrdID,
+		ClientOrderID: row.ClOrdID,
+		Symbol:        symbol,
+		Side:          side,
+		Price:         parseFloat(row.Px),
+		Quantity:      parseFloat(row.Sz),
+		FilledQty:     parseFloat(row.FillSz),
+		Status:        status,
+	}, nil
+}
+
+func (c *OKXClient) CancelOrder(symbol, orderID string) error {
+	body, _ := json.Marshal(map[string]string{
+		"instId": toOKXSymbol(symbol),
+		"ordId":  orderID,
+	})
+	_, err := c.doSigned(http.MethodPost, "/api/v5/trade/cancel-order", string(body))
+	return err
+}
+
+func (c *OKXClient) GetAccountBalance() (map[string]float64, error) {
+	respBody, err := c.doSigned(http.MethodGet, "/api/v5/account/balance", "")
+	if err != nil {
+		return nil, err
+	}
+	var env okxEnvelope
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Details []struct {
+			Ccy      string `json:"ccy"`
+			AvailBal string `json:"availBal"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(env.Data, &rows); err != nil || len(rows) == 0 {
+		return nil, fmt.Errorf("okx: empty balance")
+	}
+	balances := make(map[string]float64, len(rows[0].Details))
+	for _, d := range rows[0].Details {
+		balances[d.Ccy] = parseFloat(d.AvailBal)
+	}
+	return balances, nil
+}
+
+// subscribe 建立一条 OKX websocket 连接，使用官方要求的 ping/pong 文本帧维持心跳，断线后指数退避重连。
+// 重连循环在每次重新拨号前、以及退避等待和读取出错之后都会检查 c.done，Close 关闭这个
+// channel 后循环会在当前这一轮结束后退出，不会再继续重连、也不会再往 c.conns 里追加连接。
+func (c *OKXClient) subscribe(channel, symbol string, handle func(message []byte)) error {
+	backoff := time.Second
+	go func() {
+		for {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+
+			conn, _, err := websocket.DefaultDialer.Dial(okxWsPublicURL, nil)
+			if err != nil {
+				select {
+				case <-c.done:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = minDuration(backoff*2, 30*time.Second)
+				continue
+			}
+			backoff = time.Second
+			c.mu.Lock()
+			c.conns = append(c.conns, conn)
+			c.mu.Unlock()
+
+			sub, _ := json.Marshal(map[string]interface{}{
+				"op": "subscribe",
+				"args": []map[string]string{
+					{"channel": channel, "instId": toOKXSymbol(symbol)},
+				},
+			})
+			if err := conn.WriteMessage(websocket.TextMessage, sub); err != nil {
+				conn.Close()
+				continue
+			}
+
+			stopHeartbeat := make(chan struct{})
+			go func() {
+				ticker := time.NewTicker(20 * time.Second)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+					case <-stopHeartbeat:
+						return
+					}
+				}
+			}()
+
+			for {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					close(stopHeartbeat)
+					conn.Close()
+					break
+				}
+				if string(message) == "pong" {
+					continue
+				}
+				handle(message)
+			}
+
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *OKXClient) SubscribeTicker(symbol string, ch chan<- *Ticker) error {
+	return c.subscribe("tickers", symbol, func(message []byte) {
+		var env struct {
+			Data []struct {
+				BidPx string `json:"bidPx"`
+				BidSz string `json:"bidSz"`
+				AskPx string `json:"askPx"`
+				AskSz string `json:"askSz"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil || len(env.Data) == 0 {
+			return
+		}
+		d := env.Data[0]
+		ch <- &Ticker{
+			Symbol: symbol,
+			Bid:    parseFloat(d.BidPx),
+			BidQty: parseFloat(d.BidSz),
+			Ask:    parseFloat(d.AskPx),
+			AskQty: parseFloat(d.AskSz),
+			Time:   time.Now(),
+		}
+	})
+}
+
+// SubscribeDepth 订阅 OKX 的 books5 频道：这个频道每条推送都是前 5 档的完整快照，
+// 符合 WsAPI.SubscribeDepth 的约定。增量的 books 频道只在第一条是快照、后面全是
+// diff，不能直接当完整快照喂给调用方，那是 SubscribeDepthUpdate 该做的事。
+func (c *OKXClient) SubscribeDepth(symbol string, ch chan<- *Depth) error {
+	return c.subscribe("books5", symbol, func(message []byte) {
+		var env struct {
+			Data []struct {
+				Bids [][4]string `json:"bids"`
+				Asks [][4]string `json:"asks"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil || len(env.Data) == 0 {
+			return
+		}
+		d := env.Data[0]
+		ch <- &Depth{
+			Symbol: symbol,
+			Bids:   toLevels4(d.Bids),
+			Asks:   toLevels4(d.Asks),
+			Time:   time.Now(),
+		}
+	})
+}
+
+func (c *OKXClient) SubscribeTrades(symbol string, ch chan<- *Trade) error {
+	return c.subscribe("trades", symbol, func(message []byte) {
+		var env struct {
+			Data []struct {
+				Px   string `json:"px"`
+				Sz   string `json:"sz"`
+				Side string `json:"side"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil || len(env.Data) == 0 {
+			return
+		}
+		d := env.Data[0]
+		side := SideBuy
+		if d.Side == "sell" {
+			side = SideSell
+		}
+		ch <- &Trade{Symbol: symbol, Price: parseFloat(d.Px), Qty: parseFloat(d.Sz), Side: side, Time: time.Now()}
+	})
+}
+
+func (c *OKXClient) SubscribeDepthUpdate(symbol string, ch chan<- *DepthUpdate) error {
+	return c.subscribe("books", symbol, func(message []byte) {
+		var env struct {
+			Data []struct {
+				Bids      [][4]string `json:"bids"`
+				Asks      [][4]string `json:"asks"`
+				SeqID     int64       `json:"seqId"`
+				PrevSeqID int64       `json:"prevSeqId"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(message, &env); err != nil || len(env.Data) == 0 {
+			return
+		}
+		d := env.Data[0]
+		ch <- &DepthUpdate{
+			Symbol:        symbol,
+			FirstUpdateID: d.PrevSeqID + 1,
+			FinalUpdateID: d.SeqID,
+			Bids:          toLevels4(d.Bids),
+			Asks:          toLevels4(d.Asks),
+		}
+	})
+}
+
+func (c *OKXClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+	return nil
+}
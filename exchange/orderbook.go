@@ -0,0 +1,242 @@
+package exchange
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DepthUpdate 是一条增量深度更新（diff），qty 为 0 表示该价位被删除。
+// FirstUpdateID/FinalUpdateID 用于和 REST 快照的 lastUpdateId 对齐，避免丢更新或重复应用。
+type DepthUpdate struct {
+	Symbol        string
+	FirstUpdateID int64
+	FinalUpdateID int64
+	Bids          []DepthLevel
+	Asks          []DepthLevel
+}
+
+// OrderBook 是本地维护的某个交易对的订单簿，由一次 REST 深度快照加上之后持续的增量更新构成。
+// 三角套利需要用它来模拟扫单，而不是只看买一/卖一。
+type OrderBook struct {
+	Symbol string
+
+	mu           sync.RWMutex
+	bids         map[float64]float64 // price -> qty
+	asks         map[float64]float64
+	lastUpdateID int64
+}
+
+// NewOrderBook 创建一个尚未初始化快照的本地订单簿
+func NewOrderBook(symbol string) *OrderBook {
+	return &OrderBook{
+		Symbol: symbol,
+		bids:   make(map[float64]float64),
+		asks:   make(map[float64]float64),
+	}
+}
+
+// LoadSnapshot 用一次 REST 深度快照重置订单簿
+func (b *OrderBook) LoadSnapshot(depth *Depth, lastUpdateID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = make(map[float64]float64, len(depth.Bids))
+	for _, lvl := range depth.Bids {
+		b.bids[lvl.Price] = lvl.Qty
+	}
+	b.asks = make(map[float64]float64, len(depth.Asks))
+	for _, lvl := range depth.Asks {
+		b.asks[lvl.Price] = lvl.Qty
+	}
+	b.lastUpdateID = lastUpdateID
+}
+
+// ErrOutOfSync 表示收到的增量更新和当前快照衔接不上，调用方需要重新拉取快照
+type ErrOutOfSync struct {
+	Symbol string
+}
+
+func (e *ErrOutOfSync) Error() string {
+	return fmt.Sprintf("orderbook: %s is out of sync, need to resync from a fresh snapshot", e.Symbol)
+}
+
+// ApplyUpdate 把一条增量更新应用到本地订单簿。update.FinalUpdateID 不大于 lastUpdateID
+// 的是过期更新，直接忽略；update.FirstUpdateID 大于 lastUpdateID+1 说明中间丢了更新，
+// 返回 ErrOutOfSync。lastUpdateID 为 0 时不做这两项检查。
+func (b *OrderBook) ApplyUpdate(u *DepthUpdate) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastUpdateID != 0 {
+		if u.FinalUpdateID <= b.lastUpdateID {
+			return nil // 过期的更新，忽略
+		}
+		if u.FirstUpdateID > b.lastUpdateID+1 {
+			return &ErrOutOfSync{Symbol: b.Symbol}
+		}
+	}
+
+	for _, lvl := range u.Bids {
+		applyLevel(b.bids, lvl)
+	}
+	for _, lvl := range u.Asks {
+		applyLevel(b.asks, lvl)
+	}
+	b.lastUpdateID = u.FinalUpdateID
+	return nil
+}
+
+func applyLevel(side map[float64]float64, lvl DepthLevel) {
+	if lvl.Qty == 0 {
+		delete(side, lvl.Price)
+		return
+	}
+	side[lvl.Price] = lvl.Qty
+}
+
+// Bids 返回按价格从高到低排序的买盘档位快照
+func (b *OrderBook) Bids() []DepthLevel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	levels := levelsOf(b.bids)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Price > levels[j].Price })
+	return levels
+}
+
+// Asks 返回按价格从低到高排序的卖盘档位快照
+func (b *OrderBook) Asks() []DepthLevel {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	levels := levelsOf(b.asks)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Price < levels[j].Price })
+	return levels
+}
+
+func levelsOf(side map[float64]float64) []DepthLevel {
+	levels := make([]DepthLevel, 0, len(side))
+	for price, qty := range side {
+		levels = append(levels, DepthLevel{Price: price, Qty: qty})
+	}
+	return levels
+}
+
+// SweepAsks 模拟从卖盘由低到高吃掉最多 qty 的数量（即买入 qty），返回实际能吃到的数量
+// 和这部分成交的成交量加权均价（VWAP）。如果卖盘深度不够，filled 会小于请求的 qty。
+func (b *OrderBook) SweepAsks(qty float64) (filled float64, vwap float64) {
+	return sweep(b.Asks(), qty)
+}
+
+// SweepBids 模拟从买盘由高到低吃掉最多 qty 的数量（即卖出 qty），返回实际能吃到的数量和 VWAP
+func (b *OrderBook) SweepBids(qty float64) (filled float64, vwap float64) {
+	return sweep(b.Bids(), qty)
+}
+
+func sweep(levels []DepthLevel, qty float64) (filled float64, vwap float64) {
+	remaining := qty
+	var notional float64
+	for _, lvl := range levels {
+		if remaining <= 0 {
+			break
+		}
+		take := lvl.Qty
+		if take > remaining {
+			take = remaining
+		}
+		notional += take * lvl.Price
+		filled += take
+		remaining -= take
+	}
+	if filled == 0 {
+		return 0, 0
+	}
+	return filled, notional / filled
+}
+
+// SweepAsksByNotional 模拟用最多 notional 的计价币种（quote）从卖盘由低到高买入，
+// 返回实际买到的基础币种数量（base）、实际花掉的 quote 数量和这部分成交的 VWAP。
+// 用于持有的是某个交易对 quote 币种、要按花出去的 quote 数量而不是买入的 base 数量
+// 限定这一腿规模的场景，SweepAsks/SweepBids 按 base 数量限定，二者单位不同不能混用。
+func (b *OrderBook) SweepAsksByNotional(notional float64) (filledBase, spent, vwap float64) {
+	return sweepByNotional(b.Asks(), notional)
+}
+
+// SweepBidsByNotional 模拟用最多 notional 的计价币种从买盘由高到低卖出，
+// 返回实际卖出的 base 数量、换回的 quote 数量和这部分成交的 VWAP
+func (b *OrderBook) SweepBidsByNotional(notional float64) (filledBase, spent, vwap float64) {
+	return sweepByNotional(b.Bids(), notional)
+}
+
+func sweepByNotional(levels []DepthLevel, notional float64) (filledBase, spent, vwap float64) {
+	remaining := notional
+	for _, lvl := range levels {
+		if remaining <= 0 {
+			break
+		}
+		levelNotional := lvl.Qty * lvl.Price
+		take := lvl.Qty
+		if levelNotional > remaining {
+			take = remaining / lvl.Price
+			levelNotional = remaining
+		}
+		filledBase += take
+		spent += levelNotional
+		remaining -= levelNotional
+	}
+	if filledBase == 0 {
+		return 0, 0, 0
+	}
+	return filledBase, spent, spent / filledBase
+}
+
+// MaintainOrderBook 按交易所标准做法维护一份本地订单簿：先订阅增量更新并缓冲，
+// 再拉取一次 REST 快照作为基准，把快照带的 LastUpdateID 喂给 ApplyUpdate 的衔接检查，
+// 这样才能识别出快照之后、第一条增量更新之前丢的更新并触发重新拉快照兜底；
+// 之后陆续到达的增量更新依次应用上去。返回的 OrderBook 会持续被后台协程更新，
+// 调用方可以随时读取。注意 LastUpdateID 取决于 SpotAPI.GetDepth 的具体实现有没有
+// 把交易所的序号（lastUpdateId/seqId/version）填进 Depth，留 0 的实现衔接检查会被跳过。
+func MaintainOrderBook(api SpotAPI, ws WsAPI, symbol string, depthLimit int) (*OrderBook, error) {
+	updates := make(chan *DepthUpdate, 100)
+	if err := ws.SubscribeDepthUpdate(symbol, updates); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := api.GetDepth(symbol, depthLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	book := NewOrderBook(symbol)
+	book.LoadSnapshot(snapshot, snapshot.LastUpdateID)
+
+	go func() {
+		for u := range updates {
+			if err := book.ApplyUpdate(u); err != nil {
+				// 增量更新和快照衔接不上了，重新拉一次快照兜底
+				if fresh, err := api.GetDepth(symbol, depthLimit); err == nil {
+					book.LoadSnapshot(fresh, fresh.LastUpdateID)
+				}
+			}
+		}
+	}()
+
+	return book, nil
+}
+
+// TotalAskQty 返回卖盘全部档位的数量之和，即这一侧最多能吃到的深度
+func (b *OrderBook) TotalAskQty() float64 {
+	return totalQty(b.Asks())
+}
+
+// TotalBidQty 返回买盘全部档位的数量之和
+func (b *OrderBook) TotalBidQty() float64 {
+	return totalQty(b.Bids())
+}
+
+func totalQty(levels []DepthLevel) float64 {
+	var total float64
+	for _, lvl := range levels {
+		total += lvl.Qty
+	}
+	return total
+}
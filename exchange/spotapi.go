@@ -0,0 +1,133 @@
+package exchange
+
+import "time"
+
+// Ticker 表示某个交易对的最优一档行情
+type Ticker struct {
+	Symbol string  `json:"symbol"` // 交易对符号，统一用 BASE-QUOTE 格式，例如 FIL-ETH
+	Bid    float64 `json:"bid"`    // 买一价
+	BidQty float64 `json:"bidQty"` // 买一量
+	Ask    float64 `json:"ask"`    // 卖一价
+	AskQty float64 `json:"askQty"` // 卖一量
+	Time   time.Time
+}
+
+// DepthLevel 是订单簿上的一档价量
+type DepthLevel struct {
+	Price float64
+	Qty   float64
+}
+
+// Depth 是某个交易对的深度快照，Bids 按价格从高到低排列，Asks 按价格从低到高排列。
+// LastUpdateID 是交易所给这份快照标的序号（Binance 的 lastUpdateId、OKX 的 seqId、
+// Huobi 的 version），后续增量更新里的 FirstUpdateID/FinalUpdateID 要和它对齐，
+// 才能判断快照之后有没有丢更新；取不到序号的实现留 0，衔接检查会被跳过。
+type Depth struct {
+	Symbol       string
+	Bids         []DepthLevel
+	Asks         []DepthLevel
+	LastUpdateID int64
+	Time         time.Time
+}
+
+// Trade 是一笔成交记录
+type Trade struct {
+	Symbol string
+	Price  float64
+	Qty    float64
+	Side   Side
+	Time   time.Time
+}
+
+// Side 表示买卖方向
+type Side string
+
+const (
+	SideBuy  Side = "buy"
+	SideSell Side = "sell"
+)
+
+// OrderType 下单类型，目前只支持限价和市价
+type OrderType string
+
+const (
+	OrderTypeLimit  OrderType = "limit"
+	OrderTypeMarket OrderType = "market"
+)
+
+// OrderRequest 是下单参数
+type OrderRequest struct {
+	Symbol   string
+	Side     Side
+	Type     OrderType
+	Price    float64 // Type 为 Market 时可不填
+	Quantity float64
+
+	// ClientOrderID 是调用方（journal）生成的幂等键，随下单请求一起带给交易所
+	// （Binance 的 newClientOrderId、OKX 的 clOrdId、Huobi 的 client-order-id）。
+	// 进程崩溃在"请求已经发出但还没记下 OrderID"的窗口里时，重启后可以凭这个键
+	// 而不是交易所返回的 OrderID 去查这笔单到底下没下成，不会因为日志里缺一个
+	// OrderID 就把真实发出去、甚至已经成交的单子当成从没发生过
+	ClientOrderID string
+}
+
+// Order 是交易所返回的订单状态
+type Order struct {
+	OrderID       string
+	ClientOrderID string
+	Symbol        string
+	Side          Side
+	Price         float64
+	Quantity      float64
+	FilledQty     float64
+	Status        string // new/partially_filled/filled/canceled
+}
+
+// SpotAPI 是对各交易所现货 REST 接口的统一抽象，TriArbStrategy 只依赖这个接口，
+// 不关心具体是哪家交易所，从而可以跨交易所复用同一套套利逻辑
+type SpotAPI interface {
+	// GetAllCurrencyPair 返回交易所支持的所有交易对符号
+	GetAllCurrencyPair() ([]string, error)
+
+	// GetTicker 获取某个交易对的最优一档行情
+	GetTicker(symbol string) (*Ticker, error)
+
+	// GetDepth 获取某个交易对的订单簿深度，limit 为每边最多返回的档位数
+	GetDepth(symbol string, limit int) (*Depth, error)
+
+	// PlaceOrder 下单
+	PlaceOrder(req *OrderRequest) (*Order, error)
+
+	// GetOrder 查询一笔订单当前的状态，用于进程重启后核对某次下单到底有没有成交
+	GetOrder(symbol, orderID string) (*Order, error)
+
+	// GetOrderByClientID 按下单时带的 ClientOrderID 查询订单状态。用于重启后日志里
+	// 连 OrderID 都没记下来（PlaceOrder 请求已经发出、进程却在写下 OrderID 之前就
+	// 崩溃了）的场景：这种情况下只有当初生成的 ClientOrderID 还能对上交易所那一笔单
+	GetOrderByClientID(symbol, clientOrderID string) (*Order, error)
+
+	// CancelOrder 撤单
+	CancelOrder(symbol, orderID string) error
+
+	// GetAccountBalance 返回各币种可用余额
+	GetAccountBalance() (map[string]float64, error)
+}
+
+// WsAPI 是对各交易所 websocket 推送接口的统一抽象
+type WsAPI interface {
+	// SubscribeTicker 订阅某个交易对的行情推送，收到的数据会写入 ch
+	SubscribeTicker(symbol string, ch chan<- *Ticker) error
+
+	// SubscribeDepth 订阅某个交易对的深度推送（每次都是一份完整快照，适合只看盘口用）
+	SubscribeDepth(symbol string, ch chan<- *Depth) error
+
+	// SubscribeDepthUpdate 订阅某个交易对的增量深度更新（diff），配合 GetDepth 的快照
+	// 可以在本地维护一份完整订单簿，详见 MaintainOrderBook
+	SubscribeDepthUpdate(symbol string, ch chan<- *DepthUpdate) error
+
+	// SubscribeTrades 订阅某个交易对的逐笔成交推送
+	SubscribeTrades(symbol string, ch chan<- *Trade) error
+
+	// Close 关闭所有连接
+	Close() error
+}
@@ -0,0 +1,63 @@
+package exchange
+
+import (
+	"strconv"
+	"time"
+)
+
+// parseFloat 把交易所返回的字符串价格/数量解析为 float64，解析失败时返回 0
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// toLevels 把 [价格, 数量] 字符串对数组转换成 DepthLevel 列表
+func toLevels(raw [][2]string) []DepthLevel {
+	levels := make([]DepthLevel, 0, len(raw))
+	for _, pair := range raw {
+		levels = append(levels, DepthLevel{
+			Price: parseFloat(pair[0]),
+			Qty:   parseFloat(pair[1]),
+		})
+	}
+	return levels
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// rateLimiter 是一个简单的令牌桶限速器，用于在触发交易所的请求频率限制前主动退避
+type rateLimiter struct {
+	tokens chan struct{}
+}
+
+func newRateLimiter(n int, per time.Duration) *rateLimiter {
+	rl := &rateLimiter{tokens: make(chan struct{}, n)}
+	for i := 0; i < n; i++ {
+		rl.tokens <- struct{}{}
+	}
+	go func() {
+		ticker := time.NewTicker(per / time.Duration(n))
+		defer ticker.Stop()
+		for range ticker.C {
+			select {
+			case rl.tokens <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return rl
+}
+
+// Wait 阻塞直到拿到一个令牌
+func (rl *rateLimiter) Wait() error {
+	<-rl.tokens
+	return nil
+}
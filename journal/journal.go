@@ -0,0 +1,156 @@
+// Package journal 提供一份只追加的交易意图日志，用来在策略崩溃重启后恢复状态：
+// 每次发单前先把"打算做什么"连同一个客户端生成的幂等键落盘，交易所返回结果后
+// 再补一条记录，这样重启时回放日志、向交易所查一下最后一笔单子的真实状态，
+// 就能判断一次三角套利是该继续执行、直接收尾还是需要回滚，而不会因为进程在
+// "已发送但未确认"的窗口内崩溃而重复下单或者凭空丢掉已经成交的仓位。
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// CycleState 表示一次三角套利从计划到完成（或回滚完毕）所处的阶段
+type CycleState string
+
+const (
+	StatePlanned    CycleState = "planned"     // 已经决定要做这笔三角套利，还没发出第一条腿
+	StateLeg1Sent   CycleState = "leg1_sent"   // 第一条腿已经发给交易所，还不知道有没有成交
+	StateLeg1Filled CycleState = "leg1_filled" // 第一条腿确认成交
+	StateLeg2Sent   CycleState = "leg2_sent"
+	StateLeg2Filled CycleState = "leg2_filled"
+	StateLeg3Sent   CycleState = "leg3_sent"
+	StateLeg3Filled CycleState = "leg3_filled" // 三条腿都成交，三角套利完成
+	StateUnwinding  CycleState = "unwinding"   // 某条腿失败，正在把已经成交的腿反向平掉
+	StateUnwound    CycleState = "unwound"     // 回滚完成，仓位已经平回起点
+	StateAbandoned  CycleState = "abandoned"   // 放弃了这次三角：一条腿都没发出去，或者重启核对时最后发出的那条腿没有成交（更早成交的腿不做回滚）
+)
+
+// Terminal 判断一个状态是不是三角套利生命周期的终态：要么顺利走完三条腿，
+// 要么回滚完毕，要么已经放弃（见 StateAbandoned）。非终态的三角意味着进程上次退出时
+// 还停在半路，需要在启动时核对清楚
+func (s CycleState) Terminal() bool {
+	switch s {
+	case StateLeg3Filled, StateUnwound, StateAbandoned:
+		return true
+	default:
+		return false
+	}
+}
+
+// Entry 是日志里的一条记录，对应一次三角套利状态机的一次状态迁移
+type Entry struct {
+	CycleID        string // 一次三角套利的唯一编号
+	Sequence       int    // 这笔三角套利里的第几条腿，1/2/3；0 表示不针对某条腿的整体记录（Planned/Unwinding/Unwound）
+	State          CycleState
+	IdempotencyKey string // 发单前生成，重启后用它向交易所核对这笔单到底发没发出去
+	Symbol         string
+	Side           string
+	OrderID        string // 交易所/撮合引擎返回的订单号，Sent 记录里还没有
+	Quantity       float64
+	FilledQty      float64
+	Time           time.Time
+	Err            string
+}
+
+// Journal 是一份只追加的交易意图日志文件
+type Journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open 打开（或创建）一份日志文件用于追加写入
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("journal: open %s: %w", path, err)
+	}
+	return &Journal{file: f}, nil
+}
+
+// Append 写入一条记录并立刻刷盘：下单前的记录必须先落地，才能保证重启后能看到
+// "本来打算发这笔单"这件事本身，即便进程在请求真正发出去之前就挂了。
+//
+// 每条记录都用自己的 gob.Encoder 编码进一个独立的 buffer，再在前面加上长度前缀写盘：
+// gob 的编码器会在流的开头写一份类型定义的前导信息，如果像之前那样让同一个
+// *os.File 在进程重启后复用一个新的 Encoder 继续追加，文件里就会连续拼出好几段
+// 各自带前导信息的 gob 流，单个 Decoder 读到第二段的前导信息时会报
+// "duplicate type received"。按长度分帧后每条记录自成一个独立的 gob 流，
+// 重启多少次、谁来写都不影响后面的 Replay
+func (j *Journal) Append(e Entry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&e); err != nil {
+		return fmt.Errorf("journal: append: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(buf.Len()))
+	if _, err := j.file.Write(length[:]); err != nil {
+		return fmt.Errorf("journal: append: %w", err)
+	}
+	if _, err := j.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("journal: append: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Close 关闭日志文件
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Replay 读出日志文件里的全部记录，用于启动时重建崩溃前的状态。文件不存在时
+// 当作一份空日志处理，这样首次启动不需要额外判断
+func Replay(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("journal: open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(f, length[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("journal: read length: %w", err)
+		}
+
+		record := make([]byte, binary.BigEndian.Uint32(length[:]))
+		if _, err := io.ReadFull(f, record); err != nil {
+			return nil, fmt.Errorf("journal: read record: %w", err)
+		}
+
+		var e Entry
+		if err := gob.NewDecoder(bytes.NewReader(record)).Decode(&e); err != nil {
+			return nil, fmt.Errorf("journal: decode: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// LastByCycle 把日志记录按 CycleID 折叠成每个三角套利最后出现的那条记录，
+// 用于判断重启前哪些三角还停在中间状态，需要核对或回滚
+func LastByCycle(entries []Entry) map[string]Entry {
+	last := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		last[e.CycleID] = e
+	}
+	return last
+}
@@ -0,0 +1,121 @@
+package journal
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trade.journal")
+
+	jr, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	entries := []Entry{
+		{CycleID: "c1", Sequence: 0, State: StatePlanned},
+		{CycleID: "c1", Sequence: 1, State: StateLeg1Sent, IdempotencyKey: "c1-leg1", Symbol: "FIL-ETH"},
+		{CycleID: "c1", Sequence: 1, State: StateLeg1Filled, IdempotencyKey: "c1-leg1", Symbol: "FIL-ETH", OrderID: "o1", FilledQty: 10},
+	}
+	for _, e := range entries {
+		if err := jr.Append(e); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if err := jr.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	replayed, err := Replay(path)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if len(replayed) != len(entries) {
+		t.Fatalf("expected %d entries, got %d", len(entries), len(replayed))
+	}
+	if replayed[2].State != StateLeg1Filled || replayed[2].OrderID != "o1" {
+		t.Fatalf("unexpected last entry: %+v", replayed[2])
+	}
+}
+
+func TestAppendAcrossRestartsReplaysCleanly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trade.journal")
+
+	jr, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := jr.Append(Entry{CycleID: "c1", Sequence: 0, State: StatePlanned}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := jr.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// 模拟进程重启：重新打开同一个文件追加写入，用的是一个全新的 Encoder
+	jr, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if err := jr.Append(Entry{CycleID: "c1", Sequence: 1, State: StateLeg1Sent, IdempotencyKey: "c1-leg1"}); err != nil {
+		t.Fatalf("append after reopen: %v", err)
+	}
+	if err := jr.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	replayed, err := Replay(path)
+	if err != nil {
+		t.Fatalf("replay across restarts: %v", err)
+	}
+	if len(replayed) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(replayed))
+	}
+	if replayed[0].State != StatePlanned || replayed[1].State != StateLeg1Sent {
+		t.Fatalf("unexpected entries after restart: %+v", replayed)
+	}
+}
+
+func TestReplayMissingFileReturnsEmpty(t *testing.T) {
+	entries, err := Replay(filepath.Join(t.TempDir(), "does-not-exist.journal"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries, got %d", len(entries))
+	}
+}
+
+func TestLastByCycleKeepsOnlyLatestEntryPerCycle(t *testing.T) {
+	entries := []Entry{
+		{CycleID: "c1", State: StatePlanned},
+		{CycleID: "c2", State: StatePlanned},
+		{CycleID: "c1", State: StateLeg1Sent},
+		{CycleID: "c1", State: StateLeg1Filled},
+	}
+	last := LastByCycle(entries)
+	if len(last) != 2 {
+		t.Fatalf("expected 2 cycles, got %d", len(last))
+	}
+	if last["c1"].State != StateLeg1Filled {
+		t.Fatalf("expected c1 to be folded to its last state, got %v", last["c1"].State)
+	}
+	if last["c2"].State != StatePlanned {
+		t.Fatalf("expected c2 to still be planned, got %v", last["c2"].State)
+	}
+}
+
+func TestCycleStateTerminal(t *testing.T) {
+	terminal := []CycleState{StateLeg3Filled, StateUnwound, StateAbandoned}
+	for _, s := range terminal {
+		if !s.Terminal() {
+			t.Fatalf("expected %v to be terminal", s)
+		}
+	}
+	inFlight := []CycleState{StatePlanned, StateLeg1Sent, StateLeg1Filled, StateUnwinding}
+	for _, s := range inFlight {
+		if s.Terminal() {
+			t.Fatalf("expected %v to not be terminal", s)
+		}
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"fmt"
-	"log"
-	"net/http"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"github.com/icoolworld/trade/arb"
+	"github.com/icoolworld/trade/exchange"
+	"github.com/icoolworld/trade/journal"
+	"github.com/icoolworld/trade/matching"
 )
 
+// backtestMode 为 true 时，策略跑在本地撮合引擎上而不是真实交易所，
+// 用录制的 websocket 抓包回放做确定性回测，不会下真实订单
+const backtestMode = false
+
 // 定义三个交易对的符号
 const (
 	FIL_ETH = "FIL-ETH"
@@ -16,12 +21,8 @@ const (
 	FIL_BSV = "FIL-BSV"
 )
 
-// 定义三个交易对的价格信息结构体
-type PriceInfo struct {
-	Symbol string  `json:"symbol"` // 交易对符号
-	Bid    float64 `json:"bid"`    // 买一价
-	Ask    float64 `json:"ask"`    // 卖一价
-}
+// arbSearchIterations 是三分法搜索最优下单量的迭代次数，40 次足以把搜索区间收窄到可忽略的精度
+const arbSearchIterations = 40
 
 // 定义三角套利策略结构体
 type TriArbStrategy struct {
@@ -32,165 +33,290 @@ type TriArbStrategy struct {
 	SlipRate  float64 // 滑点率
 }
 
-// 定义三角套利策略的方法，根据三个交易对的价格信息，判断是否存在套利机会，如果有，执行相应的交易操作，并更新币量
-func (s *TriArbStrategy) Execute(prices map[string]*PriceInfo) {
-	// 获取三个交易对的价格信息
-	filEthPrice := prices[FIL_ETH]
-	ethBsvPrice := prices[ETH_BSV]
-	filBsvPrice := prices[FIL_BSV]
-
-	if filEthPrice == nil || ethBsvPrice == nil || filBsvPrice == nil {
-		return // 如果有任何一个价格信息缺失，直接返回
-	}
-
-	// 计算正向套利条件：FIL/ETH的卖一价 * ETH/BSV的卖一价 < FIL/BSV的买一价 * (1 - 手续费率) * (1 - 滑点率)
-	forwardArbCond := filEthPrice.Ask*ethBsvPrice.Ask < filBsvPrice.Bid*(1-s.CostRate)*(1-s.SlipRate)
-
-	// 计算反向套利条件：FIL/ETH的买一价 * ETH/BSV的买一价 > FIL/BSV的卖一价 * (1 + 手续费率) * (1 + 滑点率)
-	reverseArbCond := filEthPrice.Bid*ethBsvPrice.Bid > filBsvPrice.Ask*(1+s.CostRate)*(1+s.SlipRate)
-
-	if forwardArbCond {
-		// 如果存在正向套利机会，执行以下操作：
-		// 1. 用一部分FIL币（比如100个）去买ETH，假设FIL/ETH的卖一价是0.1，那么可以得到10个ETH（扣除手续费和滑点）
-		filToSell := 100.0                      // 要卖出的FIL币量
-		filCost := filToSell / (1 - s.CostRate) // 实际要花费的FIL币量（加上手续费）
-		ethToBuy := filToSell * filEthPrice.Ask // 要买入的ETH币量
-		ethGet := ethToBuy * (1 - s.SlipRate)   // 实际得到的ETH币量（扣除滑点）
-		s.FilAmount -= filCost                  // 更新FIL币量
-		s.EthAmount += ethGet                   // 更新ETH币量
-		fmt.Printf("用%.2f个FIL买入%.2f个ETH\n", filCost, ethGet)
-
-		// 2. 然后用这10个ETH去买BSV，假设ETH/BSV的卖一价是0.5，那么可以得到5个BSV（扣除手续费和滑点）
-		ethToSell := ethGet                     // 要卖出的ETH币量
-		ethCost := ethToSell / (1 - s.CostRate) // 实际要花费的ETH币量（加上手续费）
-		bsvToBuy := ethToSell * ethBsvPrice.Ask // 要买入的BSV币量
-		bsvGet := bsvToBuy * (1 - s.SlipRate)   // 实际得到的BSV币量（扣除滑点）
-		s.EthAmount -= ethCost                  // 更新ETH币量
-		s.BsvAmount += bsvGet                   // 更新BSV币量
-		fmt.Printf("用%.2f个ETH买入%.2f个BSV\n", ethCost, bsvGet)
-
-		// 3. 最后用这5个BSV去买回FIL币，假设FIL/BSV的买一价是0.04，那么可以得到125个FIL币（扣除手续费和滑点）
-		bsvToSell := bsvGet                     // 要卖出的BSV币量
-		bsvCost := bsvToSell / (1 - s.CostRate) // 实际要花费的BSV币量（加上手续费）
-		filToBuy := bsvToSell * filBsvPrice.Bid // 要买入的FIL币量
-		filGet := filToBuy * (1 - s.SlipRate)   // 实际得到的FIL币量（扣除滑点）
-		s.BsvAmount -= bsvCost                  // 更新BSV币量
-		s.FilAmount += filGet                   // 更新FIL币量
-		fmt.Printf("用%.2f个BSV买入%.2f个FIL\n", bsvCost, filGet)
-
-		fmt.Printf("完成一次正向套利，FIL币量从%.2f增加到了%.2f\n", filToSell, filGet)
-	}
-
-	if reverseArbCond {
-		// 如果存在反向套利机会，执行以下操作：
-		// 1. 用一部分FIL币（比如100个）去卖BSV，假设FIL/BSV的卖一价是0.04，那么可以得到4个BSV（扣除手续费和滑点）
-		filToSell := 100.0                      // 要卖出的FIL币量
-		filCost := filToSell / (1 - s.CostRate) // 实际要花费的FIL币量（加上手续费）
-		bsvToBuy := filToSell * filBsvPrice.Ask // 要买入的BSV币量
-		bsvGet := bsvToBuy * (1 - s.SlipRate)   // 实际得到的BSV币量（扣除滑点）
-		s.FilAmount -= filCost                  // 更新FIL币量
-		s.BsvAmount += bsvGet                   // 更新BSV币量
-		fmt.Printf("用%.2f个FIL卖出%.2f个BSV\n", filCost, bsvGet)
-
-		// 3. 最后用这2个ETH去买回FIL币，假设FIL/ETH的买一价是0.1，那么可以得到20个FIL币（扣除手续费和滑点）
-		ethToSell := ethGet                     // 要卖出的ETH币量
-		ethCost := ethToSell / (1 - s.CostRate) // 实际要花费的ETH币量（加上手续费）
-		filToBuy := ethToSell * filEthPrice.Bid // 要买入的FIL币量
-		filGet := filToBuy * (1 - s.SlipRate)   // 实际得到的FIL币量（扣除滑点）
-		s.EthAmount -= ethCost                  // 更新ETH币量
-		s.FilAmount += filGet                   // 更新FIL币量
-		fmt.Printf("用%.2f个ETH买入%.2f个FIL\n", ethCost, filGet)
-
-		fmt.Printf("完成一次反向套利，FIL币量从%.2f增加到了%.2f\n", filToSell, filGet)
+// legResult 记录三角套利单条腿实际扫单得到的数量、成交均价（VWAP）以及这一腿换到的目标币量，
+// 供下单前审计，也供 runCycle 按实际成交比例拿来更新币量，避免和模拟时的计算口径产生偏差
+type legResult struct {
+	filled float64
+	vwap   float64
+	out    float64
+}
+
+// 定义三角套利策略的方法，根据三个交易对的本地订单簿，判断是否存在套利机会：
+// 不再只看买一/卖一，而是在三条腿上同时模拟扫单，找出利润最大的下单量 q*，
+// 再把 q* 对应的三条腿交给 runCycle 按 Planned -> LegN Sent -> LegN Filled 的
+// 状态机真实下单并记录交易日志，而不是直接在内存里假设三条腿都按模拟结果成交。
+// 订单簿来自统一的 exchange.SpotAPI/WsAPI，因此同一套逻辑可以跑在任意接入的交易所上。
+func (s *TriArbStrategy) Execute(api exchange.SpotAPI, jr *journal.Journal, books map[string]*exchange.OrderBook) {
+	filEthBook := books[FIL_ETH]
+	ethBsvBook := books[ETH_BSV]
+	filBsvBook := books[FIL_BSV]
+
+	if filEthBook == nil || ethBsvBook == nil || filBsvBook == nil {
+		return // 如果有任何一个订单簿还没就绪，直接返回
+	}
+
+	if q, profit, legs, ok := s.bestSize(filEthBook.TotalBidQty(), func(q float64) (float64, [3]legResult, bool) {
+		return s.forwardProfit(q, filEthBook, ethBsvBook, filBsvBook)
+	}); ok {
+		fmt.Printf(
+			"正向套利机会：q*=%.4f FIL，预期利润=%.4f FIL，各腿VWAP=[%.6f %.6f %.6f]\n",
+			q, profit, legs[0].vwap, legs[1].vwap, legs[2].vwap,
+		)
+		cycleID := fmt.Sprintf("forward-%d", time.Now().UnixNano())
+		s.runCycle(api, jr, cycleID, [3]legPlan{
+			{Symbol: FIL_ETH, Side: exchange.SideSell, InAsset: "FIL", OutAsset: "ETH", plan: legs[0]},
+			{Symbol: ETH_BSV, Side: exchange.SideSell, InAsset: "ETH", OutAsset: "BSV", plan: legs[1]},
+			{Symbol: FIL_BSV, Side: exchange.SideBuy, InAsset: "BSV", OutAsset: "FIL", plan: legs[2]},
+		})
+	}
+
+	if q, profit, legs, ok := s.bestSize(filBsvBook.TotalBidQty(), func(q float64) (float64, [3]legResult, bool) {
+		return s.reverseProfit(q, filBsvBook, ethBsvBook, filEthBook)
+	}); ok {
+		fmt.Printf(
+			"反向套利机会：q*=%.4f FIL，预期利润=%.4f FIL，各腿VWAP=[%.6f %.6f %.6f]\n",
+			q, profit, legs[0].vwap, legs[1].vwap, legs[2].vwap,
+		)
+		cycleID := fmt.Sprintf("reverse-%d", time.Now().UnixNano())
+		s.runCycle(api, jr, cycleID, [3]legPlan{
+			{Symbol: FIL_BSV, Side: exchange.SideSell, InAsset: "FIL", OutAsset: "BSV", plan: legs[0]},
+			{Symbol: ETH_BSV, Side: exchange.SideBuy, InAsset: "BSV", OutAsset: "ETH", plan: legs[1]},
+			{Symbol: FIL_ETH, Side: exchange.SideBuy, InAsset: "ETH", OutAsset: "FIL", plan: legs[2]},
+		})
 	}
 }
 
-// 定义一个函数，用于连接交易所的websocket API，并接收三个交易对的价格信息
-func connectAndReceivePrices(url string, prices chan map[string]*PriceInfo) {
-	// 创建一个websocket客户端
-	client := &http.Client{}
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Fatal(err)
+// forwardProfit 模拟正向路径 FIL -> ETH -> BSV -> FIL 在下单量为 q（FIL）时的净利润。
+// 每一腿都用 OrderBook 的 VWAP 扫单价代替原来的买一/卖一，并要求后一腿的输入量必须能被
+// 前一腿对应档位的深度完全吃到，否则说明 q 已经超出了这条路径当前能承受的规模。
+// 前两腿手里拿着的是这个交易对的 base 币种（FIL、ETH），要卖出去换成 quote，
+// 所以吃买盘（SweepBids）、按 base 数量限定规模；最后一腿手里拿着的是 FIL-BSV 的
+// quote 币种 BSV，要拿它去买 base 币种 FIL，只能按花出去的 BSV 数量（notional）
+// 限定规模，所以吃卖盘要用 SweepAsksByNotional 而不是按 base 数量限定的 SweepAsks。
+func (s *TriArbStrategy) forwardProfit(q float64, filEthBook, ethBsvBook, filBsvBook *exchange.OrderBook) (float64, [3]legResult, bool) {
+	var legs [3]legResult
+
+	filled1, vwap1 := filEthBook.SweepBids(q)
+	if filled1 < q {
+		return 0, legs, false
 	}
-	conn, _, err := websocket.DefaultDialer.Dial(request.URL.String(), request.Header)
-	if err != nil {
-		log.Fatal(err)
+	ethOut := filled1 * vwap1 * (1 - s.CostRate) * (1 - s.SlipRate)
+	legs[0] = legResult{filled: filled1, vwap: vwap1, out: ethOut}
+
+	filled2, vwap2 := ethBsvBook.SweepBids(ethOut)
+	if filled2 < ethOut {
+		return 0, legs, false
 	}
-	defer conn.Close()
+	bsvOut := filled2 * vwap2 * (1 - s.CostRate) * (1 - s.SlipRate)
+	legs[1] = legResult{filled: filled2, vwap: vwap2, out: bsvOut}
 
-	for {
-		// 接收消息
-		messageType, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Println(err)
-			break
+	filled3, spent3, vwap3 := filBsvBook.SweepAsksByNotional(bsvOut)
+	if spent3 < bsvOut {
+		return 0, legs, false
+	}
+	filOut := filled3 * (1 - s.CostRate) * (1 - s.SlipRate)
+	legs[2] = legResult{filled: filled3, vwap: vwap3, out: filOut}
+
+	return filOut - q, legs, true
+}
+
+// reverseProfit 模拟反向路径 FIL -> BSV -> ETH -> FIL 在下单量为 q（FIL）时的净利润。
+// 第一腿手里拿着 FIL-BSV 的 base 币种 FIL，吃买盘按 base 数量限定规模；
+// 后两腿手里拿着的都是 quote 币种（ETH-BSV 的 BSV、FIL-ETH 的 ETH），要拿去买对应的
+// base 币种，只能按花出去的 quote 数量（notional）限定规模，用 SweepAsksByNotional。
+func (s *TriArbStrategy) reverseProfit(q float64, filBsvBook, ethBsvBook, filEthBook *exchange.OrderBook) (float64, [3]legResult, bool) {
+	var legs [3]legResult
+
+	filled1, vwap1 := filBsvBook.SweepBids(q)
+	if filled1 < q {
+		return 0, legs, false
+	}
+	bsvOut := filled1 * vwap1 * (1 - s.CostRate) * (1 - s.SlipRate)
+	legs[0] = legResult{filled: filled1, vwap: vwap1, out: bsvOut}
+
+	filled2, spent2, vwap2 := ethBsvBook.SweepAsksByNotional(bsvOut)
+	if spent2 < bsvOut {
+		return 0, legs, false
+	}
+	ethOut := filled2 * (1 - s.CostRate) * (1 - s.SlipRate)
+	legs[1] = legResult{filled: filled2, vwap: vwap2, out: ethOut}
+
+	filled3, spent3, vwap3 := filEthBook.SweepAsksByNotional(ethOut)
+	if spent3 < ethOut {
+		return 0, legs, false
+	}
+	filOut := filled3 * (1 - s.CostRate) * (1 - s.SlipRate)
+	legs[2] = legResult{filled: filled3, vwap: vwap3, out: filOut}
+
+	return filOut - q, legs, true
+}
+
+// bestSize 用三分法在 [0, maxQ] 上搜索使 profitFn 最大的下单量 q*。profitFn 在深度不够时
+// 返回 ok=false，这里按很差的利润处理，从而把搜索推向深度仍然充足的一侧。
+// 套利净利润作为 q 的函数是拟凹的（价格随着吃单量增大而变差），三分法可以直接收敛到 q*。
+func (s *TriArbStrategy) bestSize(maxQ float64, profitFn func(q float64) (float64, [3]legResult, bool)) (float64, float64, [3]legResult, bool) {
+	if maxQ <= 0 {
+		return 0, 0, [3]legResult{}, false
+	}
+
+	lo, hi := 0.0, maxQ
+	for i := 0; i < arbSearchIterations; i++ {
+		m1 := lo + (hi-lo)/3
+		m2 := hi - (hi-lo)/3
+		p1, _, ok1 := profitFn(m1)
+		p2, _, ok2 := profitFn(m2)
+		if !ok1 {
+			p1 = -1
+		}
+		if !ok2 {
+			p2 = -1
+		}
+		if p1 < p2 {
+			lo = m1
+		} else {
+			hi = m2
 		}
+	}
 
-		if messageType == websocket.TextMessage {
-			// 解析消息为价格信息结构体
-			var price PriceInfo
-			err = json.Unmarshal(message, &price)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
+	q := (lo + hi) / 2
+	profit, legs, ok := profitFn(q)
+	if !ok || profit <= 0 {
+		return 0, 0, legs, false
+	}
+	return q, profit, legs, true
+}
 
-			if price.Symbol == FIL_ETH || price.Symbol == ETH_BSV || price.Symbol == FIL_BSV {
-				// 如果是我们关注的三个交易对之一，就把价格信息发送到通道中
-				prices <- map[string]*PriceInfo{price.Symbol: &price}
-			}
+// maintainBooks 为关注的交易对各建立一份本地订单簿（REST快照 + 增量更新持续维护）
+func maintainBooks(api exchange.SpotAPI, ws exchange.WsAPI, symbols []string) (map[string]*exchange.OrderBook, error) {
+	books := make(map[string]*exchange.OrderBook, len(symbols))
+	for _, symbol := range symbols {
+		book, err := exchange.MaintainOrderBook(api, ws, symbol, 50)
+		if err != nil {
+			return nil, fmt.Errorf("维护%s订单簿失败: %w", symbol, err)
 		}
+		books[symbol] = book
 	}
+	return books, nil
 }
 
-func main() {
-	// 定义一个通道，用于接收三个交易对的价格信息
-	prices := make(chan map[string]*PriceInfo)
+// bestTicker 把订单簿最优一档转成一个 exchange.Ticker，供只需要买一卖一价的场景（比如
+// 建货币图找环）使用，不需要像三角套利那样做全深度扫单
+func bestTicker(book *exchange.OrderBook) *exchange.Ticker {
+	bids, asks := book.Bids(), book.Asks()
+	if len(bids) == 0 || len(asks) == 0 {
+		return nil
+	}
+	return &exchange.Ticker{
+		Symbol: book.Symbol,
+		Bid:    bids[0].Price,
+		BidQty: bids[0].Qty,
+		Ask:    asks[0].Price,
+		AskQty: asks[0].Qty,
+		Time:   time.Now(),
+	}
+}
+
+// newClients 根据 backtestMode 选择策略要跑在真实交易所还是本地撮合引擎上。
+// TriArbStrategy 和 maintainBooks 都只依赖 exchange.SpotAPI/WsAPI，两种模式下完全不用改代码。
+// feeRate 传给本地撮合引擎用于成交手续费记账，和 backtestMode=false 时真实交易所
+// 收取的手续费口径保持一致，由调用方传入 TriArbStrategy.CostRate。
+func newClients(symbols []string, feeRate float64) (exchange.SpotAPI, exchange.WsAPI) {
+	if !backtestMode {
+		client := exchange.NewBinanceClient("", "")
+		return client, client
+	}
+
+	engine := matching.NewEngine(map[string]float64{"FIL": 700.0}, feeRate)
+	for _, symbol := range symbols {
+		engine.OpenMatching(symbol)
+		// 回测用的起始盘口，真实场景下这里应该换成录制下来的 websocket 深度抓包的第一帧
+		engine.SeedFromCapture(symbol, &exchange.Depth{
+			Symbol: symbol,
+			Bids:   []exchange.DepthLevel{{Price: 1.0, Qty: 1000}},
+			Asks:   []exchange.DepthLevel{{Price: 1.01, Qty: 1000}},
+		})
+	}
+	return engine, engine
+}
 
-	// 定义一个交易所的websocket API地址（这里只是示例，实际地址可能不同）
-	url := "wss://example.com/ws"
+// seedBalances 用 GetAccountBalance 返回的真实余额初始化策略的币量，查询失败就保留
+// strategy 当前的值（零值），打印一句提示而不是让程序直接退出，后续 Execute 算出来的
+// q* 只取决于订单簿深度，余额只影响打印和 addBalance 记账，不拿到真实余额不影响下单
+func seedBalances(api exchange.SpotAPI, s *TriArbStrategy) {
+	balances, err := api.GetAccountBalance()
+	if err != nil {
+		fmt.Printf("查询账户余额失败：%v，币量先按0处理\n", err)
+		return
+	}
+	s.FilAmount = balances["FIL"]
+	s.EthAmount = balances["ETH"]
+	s.BsvAmount = balances["BSV"]
+}
 
-	// 启动一个协程，连接交易所的websocket API，并接收三个交易对的价格信息
-	go connectAndReceivePrices(url, prices)
+// tradeJournalPath 是交易意图日志的落盘位置，每次发单前后都会往这里追加一条记录
+const tradeJournalPath = "trade.journal"
 
-	// 创建一个三角套利策略实例，假设初始有700个FIL币，没有其他币，交易手续费率是0.1%，滑点率是0.01%
+func main() {
+	// 创建一个三角套利策略实例，交易手续费率是0.1%，滑点率是0.01%；起始币量随后从
+	// GetAccountBalance 拿真实余额来填，这里先留零值
 	strategy := &TriArbStrategy{
-		FilAmount: 700.0,
-		EthAmount: 0.0,
-		BsvAmount: 0.0,
-		CostRate:  0.001,
-		SlipRate:  0.0001,
+		CostRate: 0.001,
+		SlipRate: 0.0001,
 	}
 
-	// 定义一个map，用于存储三个交易对的最新价格信息
-	priceMap := make(map[string]*PriceInfo)
+	// 为三个交易对各维护一份本地订单簿，来源是真实交易所还是本地撮合引擎取决于 backtestMode
+	symbols := []string{FIL_ETH, ETH_BSV, FIL_BSV}
+	api, ws := newClients(symbols, strategy.CostRate)
+	books, err := maintainBooks(api, ws, symbols)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	for {
-		// 从通道中接收一个价格信息
-		price := <-prices
+	jr, err := journal.Open(tradeJournalPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer jr.Close()
 
-		// 更新map中对应的价格信息
-		for symbol, info := range price {
-			priceMap[symbol] = info
-		}
+	// 启动时先回放交易日志，核对上次退出前还停在半路的三角套利到底有没有真的成交，
+	// 避免重启后把一个其实已经成交（或者根本没发出去）的仓位当成别的状态来处理；
+	// reconcileJournal 可能会为没走完的三角下回滚单，所以要排在下面刷新余额之前
+	reconcileJournal(tradeJournalPath, api, jr, strategy)
+
+	// 用交易所/撮合引擎返回的真实余额初始化策略的币量，而不是猜一个初始值，这样
+	// 上面 reconcileJournal 回滚单造成的持仓变化也会被一并算进来
+	seedBalances(api, strategy)
+
+	// 同时跑一个不限定具体三角、支持任意长度环路的通用套利探测器，目前只负责发现机会并打印，
+	// 不像 TriArbStrategy 那样直接下单
+	cycleStrategy := arb.NewCycleArbStrategy(symbols, 4, strategy.CostRate, strategy.SlipRate, 2*time.Second)
+
+	lastPrint := time.Now()
+	for range time.Tick(time.Second) {
+		// 每秒基于当前订单簿重新检查一次套利机会
+		strategy.Execute(api, jr, books)
 
-		// 执行三角套利策略
-		strategy.Execute(priceMap)
+		tickers := make(map[string]*exchange.Ticker, len(symbols))
+		for _, symbol := range symbols {
+			if t := bestTicker(books[symbol]); t != nil {
+				tickers[symbol] = t
+			}
+		}
+		if cycle, profitRatio, ok := cycleStrategy.Detect(tickers, time.Now()); ok {
+			fmt.Printf("发现%d跳套利环路，预期收益倍数=%.6f：%+v\n", len(cycle), profitRatio, cycle)
+		}
 
 		// 每隔一段时间（比如10秒），打印一下当前的币量
-		ticker := time.NewTicker(10 * time.Second)
-		select {
-		case <-ticker.C:
+		if time.Since(lastPrint) >= 10*time.Second {
 			fmt.Printf(
 				"当前的币量：FIL=%.2f, ETH=%.2f, BSV=%.2f\n",
 				strategy.FilAmount,
 				strategy.EthAmount,
 				strategy.BsvAmount,
 			)
-			ticker.Stop()
-		default:
-			continue
+			lastPrint = time.Now()
 		}
 	}
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/icoolworld/trade/exchange"
+	"github.com/icoolworld/trade/journal"
+)
+
+// fakeSpotAPI only implements the bit of exchange.SpotAPI that Execute/runCycle
+// actually exercises (PlaceOrder), recording every request so tests can assert
+// on the Side/Symbol/Quantity the strategy actually sent.
+type fakeSpotAPI struct {
+	calls []*exchange.OrderRequest
+}
+
+func (f *fakeSpotAPI) GetAllCurrencyPair() ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeSpotAPI) GetTicker(symbol string) (*exchange.Ticker, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeSpotAPI) GetDepth(symbol string, limit int) (*exchange.Depth, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeSpotAPI) PlaceOrder(req *exchange.OrderRequest) (*exchange.Order, error) {
+	f.calls = append(f.calls, req)
+	return &exchange.Order{
+		OrderID:       fmt.Sprintf("o%d", len(f.calls)),
+		ClientOrderID: req.ClientOrderID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Quantity:      req.Quantity,
+		FilledQty:     req.Quantity,
+		Status:        "filled",
+	}, nil
+}
+func (f *fakeSpotAPI) GetOrder(symbol, orderID string) (*exchange.Order, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeSpotAPI) GetOrderByClientID(symbol, clientOrderID string) (*exchange.Order, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeSpotAPI) CancelOrder(symbol, orderID string) error { return errors.New("not implemented") }
+func (f *fakeSpotAPI) GetAccountBalance() (map[string]float64, error) {
+	return nil, errors.New("not implemented")
+}
+
+// failingLegSpotAPI wraps fakeSpotAPI but rejects PlaceOrder once the order count reaches
+// failAt, so tests can force a mid-triangle failure and exercise the unwind path.
+type failingLegSpotAPI struct {
+	fakeSpotAPI
+	failAt int
+}
+
+func (f *failingLegSpotAPI) PlaceOrder(req *exchange.OrderRequest) (*exchange.Order, error) {
+	if len(f.calls)+1 == f.failAt {
+		f.calls = append(f.calls, req)
+		return nil, errors.New("leg rejected")
+	}
+	return f.fakeSpotAPI.PlaceOrder(req)
+}
+
+// partialFillSpotAPI wraps fakeSpotAPI but only partially fills the order at position
+// fillAt, so tests can exercise the unwind-on-partial-fill path in runCycle.
+type partialFillSpotAPI struct {
+	fakeSpotAPI
+	fillAt    int
+	filledQty float64
+}
+
+func (f *partialFillSpotAPI) PlaceOrder(req *exchange.OrderRequest) (*exchange.Order, error) {
+	order, err := f.fakeSpotAPI.PlaceOrder(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.calls) == f.fillAt {
+		order.FilledQty = f.filledQty
+		order.Status = "partially_filled"
+	}
+	return order, nil
+}
+
+func newTestJournal(t *testing.T) *journal.Journal {
+	t.Helper()
+	jr, err := journal.Open(filepath.Join(t.TempDir(), "trade.journal"))
+	if err != nil {
+		t.Fatalf("open journal: %v", err)
+	}
+	t.Cleanup(func() { jr.Close() })
+	return jr
+}
+
+func bookWithBids(symbol string, price, qty float64) *exchange.OrderBook {
+	book := exchange.NewOrderBook(symbol)
+	book.LoadSnapshot(&exchange.Depth{Bids: []exchange.DepthLevel{{Price: price, Qty: qty}}}, 0)
+	return book
+}
+
+func bookWithAsks(symbol string, price, qty float64) *exchange.OrderBook {
+	book := exchange.NewOrderBook(symbol)
+	book.LoadSnapshot(&exchange.Depth{Asks: []exchange.DepthLevel{{Price: price, Qty: qty}}}, 0)
+	return book
+}
+
+// TestExecute_ForwardCycleSellsHeldBaseCurrency builds a book where FIL -> ETH -> BSV -> FIL
+// is profitable and checks that every leg sells the currency the strategy actually holds
+// rather than trying to buy it (the inverted Side bug would instead try to buy FIL/ETH with
+// a currency the strategy doesn't have, on the FIL-ETH/ETH-BSV books).
+func TestExecute_ForwardCycleSellsHeldBaseCurrency(t *testing.T) {
+	books := map[string]*exchange.OrderBook{
+		FIL_ETH: bookWithBids(FIL_ETH, 0.02, 1000), // sell FIL for ETH
+		ETH_BSV: bookWithBids(ETH_BSV, 300, 1000),  // sell ETH for BSV
+		FIL_BSV: bookWithAsks(FIL_BSV, 5, 1000),    // buy FIL with BSV
+	}
+	api := &fakeSpotAPI{}
+	s := &TriArbStrategy{FilAmount: 700, CostRate: 0, SlipRate: 0}
+	s.Execute(api, newTestJournal(t), books)
+
+	if len(api.calls) != 3 {
+		t.Fatalf("expected 3 order legs, got %d: %+v", len(api.calls), api.calls)
+	}
+	want := []struct {
+		symbol string
+		side   exchange.Side
+	}{
+		{FIL_ETH, exchange.SideSell},
+		{ETH_BSV, exchange.SideSell},
+		{FIL_BSV, exchange.SideBuy},
+	}
+	for i, w := range want {
+		got := api.calls[i]
+		if got.Symbol != w.symbol || got.Side != w.side {
+			t.Fatalf("leg %d: expected %s %s, got %s %s", i, w.symbol, w.side, got.Symbol, got.Side)
+		}
+		if got.Quantity <= 0 {
+			t.Fatalf("leg %d: expected positive quantity, got %v", i, got.Quantity)
+		}
+	}
+}
+
+// TestExecute_FailedLegUnwindsWithMatchingBaseQuantity forces the second leg of a
+// profitable forward triangle to be rejected and checks that unwind reverses the first
+// leg using the same base quantity that was actually sent for it (leg.plan.out would be
+// quote-denominated here and produce a different, wrong number).
+func TestExecute_FailedLegUnwindsWithMatchingBaseQuantity(t *testing.T) {
+	books := map[string]*exchange.OrderBook{
+		FIL_ETH: bookWithBids(FIL_ETH, 0.02, 1000),
+		ETH_BSV: bookWithBids(ETH_BSV, 300, 1000),
+		FIL_BSV: bookWithAsks(FIL_BSV, 5, 1000),
+	}
+	api := &failingLegSpotAPI{failAt: 2}
+	s := &TriArbStrategy{FilAmount: 700, CostRate: 0, SlipRate: 0}
+	s.Execute(api, newTestJournal(t), books)
+
+	if len(api.calls) != 3 {
+		t.Fatalf("expected leg1 + failed leg2 + unwind of leg1, got %d calls: %+v", len(api.calls), api.calls)
+	}
+
+	leg1 := api.calls[0]
+	if leg1.Symbol != FIL_ETH || leg1.Side != exchange.SideSell {
+		t.Fatalf("leg1: expected FIL-ETH sell, got %s %s", leg1.Symbol, leg1.Side)
+	}
+
+	failedLeg2 := api.calls[1]
+	if failedLeg2.Symbol != ETH_BSV {
+		t.Fatalf("expected the rejected call to be the ETH-BSV leg, got %s", failedLeg2.Symbol)
+	}
+
+	unwindLeg1 := api.calls[2]
+	if unwindLeg1.Symbol != FIL_ETH || unwindLeg1.Side != exchange.SideBuy {
+		t.Fatalf("unwind: expected a FIL-ETH buy reversing leg1, got %s %s", unwindLeg1.Symbol, unwindLeg1.Side)
+	}
+	if unwindLeg1.Quantity != leg1.Quantity {
+		t.Fatalf("unwind: expected base quantity %.6f matching leg1, got %.6f", leg1.Quantity, unwindLeg1.Quantity)
+	}
+}
+
+// TestExecute_BuyLegDebitsQuoteCurrencyNotBase checks that a filled Buy leg debits InAsset by
+// FilledQty*vwap (a quote amount), not the raw base FilledQty. The forward cycle's third leg
+// buys FIL with BSV at a flat 5 BSV/FIL book with zero fees/slippage, so the BSV earned
+// selling ETH in leg 2 should be fully spent buying FIL back in leg 3, leaving BsvAmount at
+// ~0; debiting by the base FIL quantity instead of the quote spend would leave ~4000 BSV
+// sitting unspent.
+func TestExecute_BuyLegDebitsQuoteCurrencyNotBase(t *testing.T) {
+	books := map[string]*exchange.OrderBook{
+		FIL_ETH: bookWithBids(FIL_ETH, 0.02, 1000), // sell FIL for ETH
+		ETH_BSV: bookWithBids(ETH_BSV, 300, 1000),  // sell ETH for BSV
+		FIL_BSV: bookWithAsks(FIL_BSV, 5, 1000),    // buy FIL with BSV
+	}
+	api := &fakeSpotAPI{}
+	s := &TriArbStrategy{FilAmount: 700, CostRate: 0, SlipRate: 0}
+	s.Execute(api, newTestJournal(t), books)
+
+	if len(api.calls) != 3 {
+		t.Fatalf("expected 3 order legs, got %d: %+v", len(api.calls), api.calls)
+	}
+	buyLeg := api.calls[2]
+	if buyLeg.Symbol != FIL_BSV || buyLeg.Side != exchange.SideBuy {
+		t.Fatalf("expected leg 3 to be a FIL-BSV buy, got %s %s", buyLeg.Symbol, buyLeg.Side)
+	}
+
+	if s.BsvAmount < -0.01 || s.BsvAmount > 0.01 {
+		t.Fatalf("expected BsvAmount to net out to ~0 after the round trip, got %v", s.BsvAmount)
+	}
+}
+
+// TestExecute_PartialFillUnwindsActualFilledQuantity forces the first leg of a profitable
+// forward triangle to only partially fill and checks that unwind reverses it using the
+// exchange's reported FilledQty rather than the originally planned quantity (reversing the
+// planned quantity instead would over-buy back and leave a net position).
+func TestExecute_PartialFillUnwindsActualFilledQuantity(t *testing.T) {
+	books := map[string]*exchange.OrderBook{
+		FIL_ETH: bookWithBids(FIL_ETH, 0.02, 1000),
+		ETH_BSV: bookWithBids(ETH_BSV, 300, 1000),
+		FIL_BSV: bookWithAsks(FIL_BSV, 5, 1000),
+	}
+	api := &partialFillSpotAPI{fillAt: 1, filledQty: 4}
+	s := &TriArbStrategy{FilAmount: 700, CostRate: 0, SlipRate: 0}
+	s.Execute(api, newTestJournal(t), books)
+
+	if len(api.calls) != 2 {
+		t.Fatalf("expected leg1 + unwind of leg1, got %d calls: %+v", len(api.calls), api.calls)
+	}
+
+	leg1 := api.calls[0]
+	if leg1.Symbol != FIL_ETH || leg1.Side != exchange.SideSell {
+		t.Fatalf("leg1: expected FIL-ETH sell, got %s %s", leg1.Symbol, leg1.Side)
+	}
+
+	unwindLeg1 := api.calls[1]
+	if unwindLeg1.Symbol != FIL_ETH || unwindLeg1.Side != exchange.SideBuy {
+		t.Fatalf("unwind: expected a FIL-ETH buy reversing leg1, got %s %s", unwindLeg1.Symbol, unwindLeg1.Side)
+	}
+	if unwindLeg1.Quantity != 4 {
+		t.Fatalf("unwind: expected to reverse the actually filled quantity 4, got %.6f", unwindLeg1.Quantity)
+	}
+}
+
+// TestExecute_ReverseCycleSellsHeldBaseCurrency mirrors the forward case for the
+// FIL -> BSV -> ETH -> FIL path.
+func TestExecute_ReverseCycleSellsHeldBaseCurrency(t *testing.T) {
+	books := map[string]*exchange.OrderBook{
+		FIL_ETH: bookWithAsks(FIL_ETH, 0.01, 1000), // buy FIL with ETH
+		ETH_BSV: bookWithAsks(ETH_BSV, 100, 1000),  // buy ETH with BSV
+		FIL_BSV: bookWithBids(FIL_BSV, 6, 1000),    // sell FIL for BSV
+	}
+	api := &fakeSpotAPI{}
+	s := &TriArbStrategy{FilAmount: 700, CostRate: 0, SlipRate: 0}
+	s.Execute(api, newTestJournal(t), books)
+
+	if len(api.calls) != 3 {
+		t.Fatalf("expected 3 order legs, got %d: %+v", len(api.calls), api.calls)
+	}
+	want := []struct {
+		symbol string
+		side   exchange.Side
+	}{
+		{FIL_BSV, exchange.SideSell},
+		{ETH_BSV, exchange.SideBuy},
+		{FIL_ETH, exchange.SideBuy},
+	}
+	for i, w := range want {
+		got := api.calls[i]
+		if got.Symbol != w.symbol || got.Side != w.side {
+			t.Fatalf("leg %d: expected %s %s, got %s %s", i, w.symbol, w.side, got.Symbol, got.Side)
+		}
+		if got.Quantity <= 0 {
+			t.Fatalf("leg %d: expected positive quantity, got %v", i, got.Quantity)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package matching
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/icoolworld/trade/exchange"
+)
+
+// ErrBookClosed 表示该交易对的撮合还没开盘或者已经收盘，此时不接受下单
+var ErrBookClosed = errors.New("matching: book is closed")
+
+// ErrOrderNotFound 表示撤单时找不到对应的挂单，可能已经成交或被撤销
+var ErrOrderNotFound = errors.New("matching: order not found")
+
+// Fill 是一次成交对某一方订单产生的回报，PlaceOrder 的主动方和被动方各会收到一条
+type Fill struct {
+	OrderID string
+	Symbol  string
+	Side    exchange.Side
+	Price   float64
+	Qty     float64
+	Time    time.Time
+}
+
+// restingOrder 是撮合簿上挂着的一笔限价单
+type restingOrder struct {
+	id        string
+	side      exchange.Side
+	price     float64
+	remaining float64
+	seq       int64 // 下单的全局序号，相同价格下序号小的优先成交，实现价格-时间优先
+}
+
+// Book 是单个交易对的价格-时间优先限价撮合簿，可以用来做纸上交易和回测：
+// 行情来自本地撮合而不是真实交易所，但下单/撤单走的是和 exchange.SpotAPI 一致的接口形状
+type Book struct {
+	Symbol string
+
+	mu   sync.Mutex
+	open bool
+	seq  int64
+	bids []*restingOrder // 按价格从高到低、同价按 seq 从小到大排列
+	asks []*restingOrder // 按价格从低到高、同价按 seq 从小到大排列
+
+	orders map[string]*exchange.Order // 每笔订单当前状态的快照，供 GetOrder 查询
+
+	trades chan *exchange.Trade
+	fills  chan *Fill
+}
+
+// newBook 创建一个尚未开盘的撮合簿
+func newBook(symbol string) *Book {
+	return &Book{
+		Symbol: symbol,
+		orders: make(map[string]*exchange.Order),
+		trades: make(chan *exchange.Trade, 1024),
+		fills:  make(chan *Fill, 1024),
+	}
+}
+
+// Open 开盘，开始接受下单
+func (b *Book) Open() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open = true
+}
+
+// Close 收盘，之后的下单会返回 ErrBookClosed；已经挂着的单不受影响，方便开盘后继续撮合
+func (b *Book) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open = false
+}
+
+// Trades 返回这个撮合簿的成交流
+func (b *Book) Trades() <-chan *exchange.Trade {
+	return b.trades
+}
+
+// Fills 返回这个撮合簿的回报流，主动方和被动方各收到一条
+func (b *Book) Fills() <-chan *Fill {
+	return b.fills
+}
+
+// PlaceOrder 按价格-时间优先撮合一笔新订单：先尽可能和对手盘成交，剩余数量（仅限价单）挂到本方队列上
+func (b *Book) PlaceOrder(req *exchange.OrderRequest) (*exchange.Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return nil, ErrBookClosed
+	}
+
+	b.seq++
+	incoming := &restingOrder{
+		id:        strconv.FormatInt(b.seq, 10),
+		side:      req.Side,
+		price:     req.Price,
+		remaining: req.Quantity,
+		seq:       b.seq,
+	}
+
+	opposite := &b.asks
+	if req.Side == exchange.SideSell {
+		opposite = &b.bids
+	}
+
+	var filledQty float64
+	for incoming.remaining > 0 && len(*opposite) > 0 {
+		best := (*opposite)[0]
+		if req.Type == exchange.OrderTypeLimit && !crosses(req.Side, req.Price, best.price) {
+			break
+		}
+
+		tradeQty := min(incoming.remaining, best.remaining)
+		tradePrice := best.price // 成交价以挂单方（maker）的价格为准
+		incoming.remaining -= tradeQty
+		best.remaining -= tradeQty
+		filledQty += tradeQty
+
+		now := time.Now()
+		b.trades <- &exchange.Trade{Symbol: b.Symbol, Price: tradePrice, Qty: tradeQty, Side: req.Side, Time: now}
+		b.fills <- &Fill{OrderID: incoming.id, Symbol: b.Symbol, Side: incoming.side, Price: tradePrice, Qty: tradeQty, Time: now}
+		b.fills <- &Fill{OrderID: best.id, Symbol: b.Symbol, Side: best.side, Price: tradePrice, Qty: tradeQty, Time: now}
+
+		makerOrder := b.orders[best.id]
+		makerOrder.FilledQty += tradeQty
+		if best.remaining <= 0 {
+			makerOrder.Status = "filled"
+			*opposite = (*opposite)[1:]
+		} else {
+			makerOrder.Status = "partially_filled"
+		}
+	}
+
+	status := "new"
+	switch {
+	case filledQty >= req.Quantity:
+		status = "filled"
+	case filledQty > 0:
+		status = "partially_filled"
+	}
+
+	if incoming.remaining > 0 {
+		if req.Type != exchange.OrderTypeLimit {
+			// 市价单吃不完就作废剩余部分，不会挂在簿子上
+			incoming.remaining = 0
+		} else {
+			b.insert(incoming)
+		}
+	}
+
+	order := &exchange.Order{
+		OrderID:       incoming.id,
+		ClientOrderID: req.ClientOrderID,
+		Symbol:        b.Symbol,
+		Side:          req.Side,
+		Price:         req.Price,
+		Quantity:      req.Quantity,
+		FilledQty:     filledQty,
+		Status:        status,
+	}
+	b.orders[incoming.id] = order
+	return order, nil
+}
+
+// crosses 判断买单/卖单的限价是否能和对手盘的某个价位成交
+func crosses(side exchange.Side, limitPrice, oppositePrice float64) bool {
+	if side == exchange.SideBuy {
+		return limitPrice >= oppositePrice
+	}
+	return limitPrice <= oppositePrice
+}
+
+// insert 把一笔未成交完的限价单插入本方队列，维持价格优先、同价按 seq（先到先得）排列
+func (b *Book) insert(o *restingOrder) {
+	side := &b.bids
+	better := func(a, c *restingOrder) bool { return a.price > c.price || (a.price == c.price && a.seq < c.seq) }
+	if o.side == exchange.SideSell {
+		side = &b.asks
+		better = func(a, c *restingOrder) bool { return a.price < c.price || (a.price == c.price && a.seq < c.seq) }
+	}
+
+	i := 0
+	for i < len(*side) && better((*side)[i], o) {
+		i++
+	}
+	*side = append(*side, nil)
+	copy((*side)[i+1:], (*side)[i:])
+	(*side)[i] = o
+}
+
+// GetOrder 查询一笔订单当前的状态快照
+func (b *Book) GetOrder(orderID string) (*exchange.Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	order, ok := b.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+// GetOrderByClientID 按下单时带的 ClientOrderID 查询订单状态快照
+func (b *Book) GetOrderByClientID(clientOrderID string) (*exchange.Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, order := range b.orders {
+		if order.ClientOrderID == clientOrderID {
+			copied := *order
+			return &copied, nil
+		}
+	}
+	return nil, ErrOrderNotFound
+}
+
+// CancelOrder 撤销一笔还挂在簿子上的限价单
+func (b *Book) CancelOrder(orderID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, side := range []*[]*restingOrder{&b.bids, &b.asks} {
+		for i, o := range *side {
+			if o.id == orderID {
+				*side = append((*side)[:i], (*side)[i+1:]...)
+				if order, ok := b.orders[orderID]; ok {
+					order.Status = "canceled"
+				}
+				return nil
+			}
+		}
+	}
+	return ErrOrderNotFound
+}
+
+// Depth 把当前挂单按价位聚合成一份深度快照
+func (b *Book) Depth(limit int) *exchange.Depth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return &exchange.Depth{
+		Symbol: b.Symbol,
+		Bids:   aggregate(b.bids, limit),
+		Asks:   aggregate(b.asks, limit),
+		Time:   time.Now(),
+	}
+}
+
+func aggregate(orders []*restingOrder, limit int) []exchange.DepthLevel {
+	levels := make([]exchange.DepthLevel, 0, limit)
+	for _, o := range orders {
+		if len(levels) > 0 && levels[len(levels)-1].Price == o.price {
+			levels[len(levels)-1].Qty += o.remaining
+			continue
+		}
+		if len(levels) >= limit {
+			break
+		}
+		levels = append(levels, exchange.DepthLevel{Price: o.price, Qty: o.remaining})
+	}
+	return levels
+}
+
+// Ticker 把当前最优买卖档汇总成一个 Ticker，买卖任意一侧为空时返回 nil
+func (b *Book) Ticker() *exchange.Ticker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.bids) == 0 || len(b.asks) == 0 {
+		return nil
+	}
+	return &exchange.Ticker{
+		Symbol: b.Symbol,
+		Bid:    b.bids[0].price,
+		BidQty: b.bids[0].remaining,
+		Ask:    b.asks[0].price,
+		AskQty: b.asks[0].remaining,
+		Time:   time.Now(),
+	}
+}
+
+// Seed 用一份深度快照给撮合簿铺底，常见用法是把交易所抓回来的 websocket 深度录像喂进来，
+// 这样回测时盘口深度和真实行情保持一致。铺底用的挂单 id 带 seed- 前缀，side 按所在的
+// 买盘/卖盘填好，撤单和普通挂单一样按 id 匹配。
+func (b *Book) Seed(depth *exchange.Depth) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = b.bids[:0]
+	b.asks = b.asks[:0]
+	for _, lvl := range depth.Bids {
+		b.seq++
+		o := &restingOrder{id: "seed-" + strconv.FormatInt(b.seq, 10), side: exchange.SideBuy, price: lvl.Price, remaining: lvl.Qty, seq: b.seq}
+		b.bids = append(b.bids, o)
+		b.orders[o.id] = &exchange.Order{OrderID: o.id, Symbol: b.Symbol, Side: o.side, Price: o.price, Quantity: lvl.Qty, Status: "new"}
+	}
+	for _, lvl := range depth.Asks {
+		b.seq++
+		o := &restingOrder{id: "seed-" + strconv.FormatInt(b.seq, 10), side: exchange.SideSell, price: lvl.Price, remaining: lvl.Qty, seq: b.seq}
+		b.asks = append(b.asks, o)
+		b.orders[o.id] = &exchange.Order{OrderID: o.id, Symbol: b.Symbol, Side: o.side, Price: o.price, Quantity: lvl.Qty, Status: "new"}
+	}
+}
+
+func min(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
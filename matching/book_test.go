@@ -0,0 +1,96 @@
+package matching
+
+import (
+	"testing"
+
+	"github.com/icoolworld/trade/exchange"
+)
+
+func newOpenBook(symbol string) *Book {
+	b := newBook(symbol)
+	b.Open()
+	return b
+}
+
+func TestBook_PriceTimePriority(t *testing.T) {
+	b := newOpenBook("FIL-ETH")
+
+	first, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideBuy, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideBuy, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 卖单数量只够吃掉其中一个买单，应该优先成交先挂的 first
+	sell, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideSell, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sell.FilledQty != 5 || sell.Status != "filled" {
+		t.Fatalf("expected sell order fully filled, got %+v", sell)
+	}
+
+	if err := b.CancelOrder(first.OrderID); err == nil {
+		t.Fatalf("expected first order to already be filled and gone, cancel should fail")
+	}
+	if err := b.CancelOrder(second.OrderID); err != nil {
+		t.Fatalf("expected second order to still be resting: %v", err)
+	}
+}
+
+func TestBook_PartialFill(t *testing.T) {
+	b := newOpenBook("FIL-ETH")
+
+	if _, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideBuy, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sell, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideSell, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sell.FilledQty != 3 || sell.Status != "partially_filled" {
+		t.Fatalf("expected partial fill of 3, got %+v", sell)
+	}
+
+	depth := b.Depth(10)
+	if len(depth.Bids) != 0 {
+		t.Fatalf("expected the buy side to be fully consumed, got %+v", depth.Bids)
+	}
+	if len(depth.Asks) != 1 || depth.Asks[0].Qty != 7 {
+		t.Fatalf("expected 7 remaining on the ask side, got %+v", depth.Asks)
+	}
+}
+
+func TestBook_RejectsOrdersWhenClosed(t *testing.T) {
+	b := newBook("FIL-ETH") // 没调用 Open
+
+	_, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideBuy, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 1})
+	if err != ErrBookClosed {
+		t.Fatalf("expected ErrBookClosed, got %v", err)
+	}
+}
+
+func TestBook_MarketOrderDoesNotRest(t *testing.T) {
+	b := newOpenBook("FIL-ETH")
+
+	if _, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideSell, Type: exchange.OrderTypeLimit, Price: 1.0, Quantity: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buy, err := b.PlaceOrder(&exchange.OrderRequest{Symbol: "FIL-ETH", Side: exchange.SideBuy, Type: exchange.OrderTypeMarket, Quantity: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buy.FilledQty != 2 {
+		t.Fatalf("expected market order to fill the available 2, got %+v", buy)
+	}
+
+	depth := b.Depth(10)
+	if len(depth.Bids) != 0 {
+		t.Fatalf("expected unfilled remainder of the market order not to rest on the book, got %+v", depth.Bids)
+	}
+}
@@ -0,0 +1,352 @@
+package matching
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/icoolworld/trade/exchange"
+)
+
+// Engine 是一个进程内的撮合引擎，给每个交易对维护一份 Book。它同时实现了
+// exchange.SpotAPI 和 exchange.WsAPI，因此 main.go 里拿着 exchange.SpotAPI/WsAPI
+// 编写的策略代码不用改一行，就能把行情来源从真实交易所换成本地撮合，
+// 用录制下来的 websocket 行情回放做确定性回测，或者在没有资金风险的情况下跑纸上交易。
+// 每笔成交都会按 feeRate 扣一笔手续费、借记成交方付出的币种、贷记收到的币种，
+// 让 GetAccountBalance 反映纸上交易账户的真实持仓，而不是创建时的初始快照。
+type Engine struct {
+	mu      sync.Mutex
+	books   map[string]*Book
+	subs    map[string]*subscribers
+	feeRate float64
+
+	balanceMu sync.Mutex
+	balances  map[string]float64
+}
+
+// subscribers 自己带一把锁：dispatch 在 book.Trades() 的消费 goroutine 里读订阅者切片、
+// 累加 updateSeq，Subscribe*/GetDepth 在调用方各自的 goroutine 里追加切片、读 updateSeq，
+// 两边并不是同一个 goroutine，不能只靠 Engine.mu 在查出 *subscribers 指针那一下保护住
+type subscribers struct {
+	mu           sync.Mutex
+	tickers      []chan<- *exchange.Ticker
+	depths       []chan<- *exchange.Depth
+	depthUpdates []chan<- *exchange.DepthUpdate
+	trades       []chan<- *exchange.Trade
+	updateSeq    int64
+}
+
+// NewEngine 创建一个撮合引擎，initialBalances 是纸上交易账户的起始余额，
+// feeRate 是每笔成交扣的手续费率，和 TriArbStrategy.CostRate 的口径一致
+func NewEngine(initialBalances map[string]float64, feeRate float64) *Engine {
+	balances := make(map[string]float64, len(initialBalances))
+	for asset, amount := range initialBalances {
+		balances[asset] = amount
+	}
+	return &Engine{
+		books:    make(map[string]*Book),
+		subs:     make(map[string]*subscribers),
+		balances: balances,
+		feeRate:  feeRate,
+	}
+}
+
+// OpenMatching 为某个交易对开盘，如果之前已经开过就直接复用同一份 Book（方便重复调用）
+func (e *Engine) OpenMatching(symbol string) *Book {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if book, ok := e.books[symbol]; ok {
+		book.Open()
+		return book
+	}
+
+	book := newBook(symbol)
+	book.Open()
+	e.books[symbol] = book
+	e.subs[symbol] = &subscribers{}
+	go e.dispatch(symbol, book)
+	go e.applyFills(symbol, book)
+	return book
+}
+
+// CloseMatching 给某个交易对收盘，之后的下单会被拒绝，但挂单和订阅关系都还在
+func (e *Engine) CloseMatching(symbol string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	book, ok := e.books[symbol]
+	if !ok {
+		return fmt.Errorf("matching: %s has not been opened", symbol)
+	}
+	book.Close()
+	return nil
+}
+
+// dispatch 把一个 Book 上产生的成交广播给订阅了行情的 channel：每笔成交之后都重新
+// 计算一次最优一档和聚合深度推给 ticker/depth 订阅者，并把这次的深度快照当作一条
+// 增量更新（本地撮合的全量状态已知，没必要区分快照和 diff）推给 depth-update 订阅者。
+// 订阅者切片和 updateSeq 在 sub.mu 下拷贝出来再发送，不把锁攥在手里堵在 channel 发送上，
+// 也不会和 Subscribe*/GetDepth 另一边的读写并发越过锁
+func (e *Engine) dispatch(symbol string, book *Book) {
+	for trade := range book.Trades() {
+		e.mu.Lock()
+		sub := e.subs[symbol]
+		e.mu.Unlock()
+		if sub == nil {
+			continue
+		}
+
+		sub.mu.Lock()
+		trades := append([]chan<- *exchange.Trade(nil), sub.trades...)
+		tickers := append([]chan<- *exchange.Ticker(nil), sub.tickers...)
+		depths := append([]chan<- *exchange.Depth(nil), sub.depths...)
+		depthUpdates := append([]chan<- *exchange.DepthUpdate(nil), sub.depthUpdates...)
+		sub.updateSeq++
+		seq := sub.updateSeq
+		sub.mu.Unlock()
+
+		for _, ch := range trades {
+			ch <- trade
+		}
+
+		ticker := book.Ticker()
+		for _, ch := range tickers {
+			if ticker != nil {
+				ch <- ticker
+			}
+		}
+
+		depth := book.Depth(50)
+		for _, ch := range depths {
+			ch <- depth
+		}
+
+		update := &exchange.DepthUpdate{
+			Symbol:        symbol,
+			FirstUpdateID: seq,
+			FinalUpdateID: seq,
+			Bids:          depth.Bids,
+			Asks:          depth.Asks,
+		}
+		for _, ch := range depthUpdates {
+			ch <- update
+		}
+	}
+}
+
+// seedOrderPrefix 是 Book.Seed 铺底用的合成挂单 id 前缀，代表市场上别人的深度，
+// 不属于纸上交易账户，成交时不应该影响 e.balances
+const seedOrderPrefix = "seed-"
+
+// applyFills 消费一个 Book 的成交回报，把每一笔真实账户自己的成交（排除 Seed 铺底
+// 的合成挂单）按 feeRate 记到 e.balances 上：买方向扣 quote 发 base，卖方向扣 base 发
+// quote，net of fee 的一侧永远是收到的那个币种，这样 GetAccountBalance 才能反映回测
+// 过程中实际发生的持仓变化，而不是创建时的初始快照
+func (e *Engine) applyFills(symbol string, book *Book) {
+	base, quote, ok := splitSymbol(symbol)
+	if !ok {
+		return
+	}
+
+	for fill := range book.Fills() {
+		if strings.HasPrefix(fill.OrderID, seedOrderPrefix) {
+			continue
+		}
+
+		e.balanceMu.Lock()
+		notional := fill.Price * fill.Qty
+		if fill.Side == exchange.SideBuy {
+			e.balances[quote] -= notional
+			e.balances[base] += fill.Qty * (1 - e.feeRate)
+		} else {
+			e.balances[base] -= fill.Qty
+			e.balances[quote] += notional * (1 - e.feeRate)
+		}
+		e.balanceMu.Unlock()
+	}
+}
+
+// splitSymbol 把 BASE-QUOTE 格式的交易对符号拆成两个币种
+func splitSymbol(symbol string) (base, quote string, ok bool) {
+	parts := strings.SplitN(symbol, "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func (e *Engine) book(symbol string) (*Book, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	book, ok := e.books[symbol]
+	if !ok {
+		return nil, fmt.Errorf("matching: %s has not been opened, call OpenMatching first", symbol)
+	}
+	return book, nil
+}
+
+// GetAllCurrencyPair 返回所有已经开盘过的交易对
+func (e *Engine) GetAllCurrencyPair() ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	symbols := make([]string, 0, len(e.books))
+	for symbol := range e.books {
+		symbols = append(symbols, symbol)
+	}
+	return symbols, nil
+}
+
+// GetTicker 返回某个交易对当前的最优一档
+func (e *Engine) GetTicker(symbol string) (*exchange.Ticker, error) {
+	book, err := e.book(symbol)
+	if err != nil {
+		return nil, err
+	}
+	ticker := book.Ticker()
+	if ticker == nil {
+		return nil, fmt.Errorf("matching: %s has no liquidity on one side", symbol)
+	}
+	return ticker, nil
+}
+
+// GetDepth 返回某个交易对当前的聚合深度，LastUpdateID 取自撮合引擎给这个交易对
+// 维护的增量更新序号，和 SubscribeDepthUpdate 推出去的 FirstUpdateID/FinalUpdateID
+// 是同一个计数器，这样 MaintainOrderBook 才能把快照和之后的增量更新对上
+func (e *Engine) GetDepth(symbol string, limit int) (*exchange.Depth, error) {
+	book, err := e.book(symbol)
+	if err != nil {
+		return nil, err
+	}
+	depth := book.Depth(limit)
+	if sub, err := e.subsFor(symbol); err == nil {
+		sub.mu.Lock()
+		depth.LastUpdateID = sub.updateSeq
+		sub.mu.Unlock()
+	}
+	return depth, nil
+}
+
+// PlaceOrder 把订单交给对应交易对的撮合簿处理
+func (e *Engine) PlaceOrder(req *exchange.OrderRequest) (*exchange.Order, error) {
+	book, err := e.book(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	return book.PlaceOrder(req)
+}
+
+// GetOrder 查询某个交易对上一笔订单当前的状态
+func (e *Engine) GetOrder(symbol, orderID string) (*exchange.Order, error) {
+	book, err := e.book(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return book.GetOrder(orderID)
+}
+
+// GetOrderByClientID 按下单时带的 ClientOrderID 查询订单状态
+func (e *Engine) GetOrderByClientID(symbol, clientOrderID string) (*exchange.Order, error) {
+	book, err := e.book(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return book.GetOrderByClientID(clientOrderID)
+}
+
+// SeedFromCapture 用一份录制下来的深度快照给某个交易对的撮合簿铺底，典型用法是把
+// websocket 抓包回放出来的第一帧深度喂进来，这样回测一开始盘口就和当时的真实行情一致
+func (e *Engine) SeedFromCapture(symbol string, depth *exchange.Depth) error {
+	book, err := e.book(symbol)
+	if err != nil {
+		return err
+	}
+	book.Seed(depth)
+	return nil
+}
+
+// CancelOrder 撤销某个交易对上的一笔挂单
+func (e *Engine) CancelOrder(symbol, orderID string) error {
+	book, err := e.book(symbol)
+	if err != nil {
+		return err
+	}
+	return book.CancelOrder(orderID)
+}
+
+// GetAccountBalance 返回纸上交易账户当前的余额快照
+func (e *Engine) GetAccountBalance() (map[string]float64, error) {
+	e.balanceMu.Lock()
+	defer e.balanceMu.Unlock()
+	balances := make(map[string]float64, len(e.balances))
+	for asset, amount := range e.balances {
+		balances[asset] = amount
+	}
+	return balances, nil
+}
+
+// SubscribeTicker 订阅某个交易对每次成交后的最新最优一档
+func (e *Engine) SubscribeTicker(symbol string, ch chan<- *exchange.Ticker) error {
+	sub, err := e.subsFor(symbol)
+	if err != nil {
+		return err
+	}
+	sub.mu.Lock()
+	sub.tickers = append(sub.tickers, ch)
+	sub.mu.Unlock()
+	return nil
+}
+
+// SubscribeDepth 订阅某个交易对每次成交后的聚合深度快照
+func (e *Engine) SubscribeDepth(symbol string, ch chan<- *exchange.Depth) error {
+	sub, err := e.subsFor(symbol)
+	if err != nil {
+		return err
+	}
+	sub.mu.Lock()
+	sub.depths = append(sub.depths, ch)
+	sub.mu.Unlock()
+	return nil
+}
+
+// SubscribeDepthUpdate 订阅某个交易对每次成交后的深度更新
+func (e *Engine) SubscribeDepthUpdate(symbol string, ch chan<- *exchange.DepthUpdate) error {
+	sub, err := e.subsFor(symbol)
+	if err != nil {
+		return err
+	}
+	sub.mu.Lock()
+	sub.depthUpdates = append(sub.depthUpdates, ch)
+	sub.mu.Unlock()
+	return nil
+}
+
+// SubscribeTrades 订阅某个交易对的逐笔成交
+func (e *Engine) SubscribeTrades(symbol string, ch chan<- *exchange.Trade) error {
+	sub, err := e.subsFor(symbol)
+	if err != nil {
+		return err
+	}
+	sub.mu.Lock()
+	sub.trades = append(sub.trades, ch)
+	sub.mu.Unlock()
+	return nil
+}
+
+func (e *Engine) subsFor(symbol string) (*subscribers, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sub, ok := e.subs[symbol]
+	if !ok {
+		return nil, fmt.Errorf("matching: %s has not been opened, call OpenMatching first", symbol)
+	}
+	return sub, nil
+}
+
+// Close 对本地撮合引擎而言没有真实连接要断开，这里只是满足 exchange.WsAPI 接口
+func (e *Engine) Close() error {
+	return nil
+}
+
+var _ exchange.SpotAPI = (*Engine)(nil)
+var _ exchange.WsAPI = (*Engine)(nil)
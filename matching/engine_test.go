@@ -0,0 +1,115 @@
+package matching
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/icoolworld/trade/exchange"
+)
+
+func TestEngine_PlaceOrderUpdatesBalancesNetOfFee(t *testing.T) {
+	engine := NewEngine(map[string]float64{"FIL": 100, "ETH": 0}, 0.01)
+	engine.OpenMatching("FIL-ETH")
+	if err := engine.SeedFromCapture("FIL-ETH", &exchange.Depth{
+		Bids: []exchange.DepthLevel{{Price: 1.0, Qty: 1000}},
+		Asks: []exchange.DepthLevel{{Price: 1.0, Qty: 1000}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if _, err := engine.PlaceOrder(&exchange.OrderRequest{
+		Symbol: "FIL-ETH", Side: exchange.SideSell, Type: exchange.OrderTypeMarket, Quantity: 10,
+	}); err != nil {
+		t.Fatalf("place order: %v", err)
+	}
+
+	// 给撮合引擎的后台 goroutine 一点时间把成交记到 balances 上
+	time.Sleep(50 * time.Millisecond)
+
+	balances, err := engine.GetAccountBalance()
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	if got, want := balances["FIL"], 90.0; got != want {
+		t.Fatalf("expected FIL balance %v, got %v", want, got)
+	}
+	if got, want := balances["ETH"], 10*1.0*(1-0.01); got != want {
+		t.Fatalf("expected ETH balance %v, got %v", want, got)
+	}
+}
+
+// TestEngine_SeededLiquidityDoesNotAffectBalances 确认吃到 Seed 铺底的合成挂单时，
+// 只有账户自己那一side的成交会记到 balances 上，铺底那一side（seed- 前缀）不会重复记账
+func TestEngine_SeededLiquidityDoesNotAffectBalances(t *testing.T) {
+	engine := NewEngine(map[string]float64{"FIL": 0, "ETH": 100}, 0.01)
+	engine.OpenMatching("FIL-ETH")
+	if err := engine.SeedFromCapture("FIL-ETH", &exchange.Depth{
+		Asks: []exchange.DepthLevel{{Price: 1.0, Qty: 1000}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if _, err := engine.PlaceOrder(&exchange.OrderRequest{
+		Symbol: "FIL-ETH", Side: exchange.SideBuy, Type: exchange.OrderTypeMarket, Quantity: 10,
+	}); err != nil {
+		t.Fatalf("place order: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	balances, err := engine.GetAccountBalance()
+	if err != nil {
+		t.Fatalf("get balance: %v", err)
+	}
+	if got, want := balances["ETH"], 90.0; got != want {
+		t.Fatalf("expected ETH balance %v, got %v", want, got)
+	}
+	if got, want := balances["FIL"], 10*(1-0.01); got != want {
+		t.Fatalf("expected FIL balance %v, got %v", want, got)
+	}
+}
+
+// TestEngine_ConcurrentSubscribeAndDispatchDoesNotRace drives dispatch (filling orders on a
+// background goroutine) and Subscribe*/GetDepth (appending to the subscriber slices and reading
+// updateSeq from other goroutines) at the same time. It doesn't assert on a result - run with
+// -race, it only catches anything if subscribers' slices/updateSeq aren't properly locked.
+func TestEngine_ConcurrentSubscribeAndDispatchDoesNotRace(t *testing.T) {
+	engine := NewEngine(map[string]float64{"FIL": 1000, "ETH": 1000}, 0.01)
+	engine.OpenMatching("FIL-ETH")
+	if err := engine.SeedFromCapture("FIL-ETH", &exchange.Depth{
+		Bids: []exchange.DepthLevel{{Price: 1.0, Qty: 1000}},
+		Asks: []exchange.DepthLevel{{Price: 1.0, Qty: 1000}},
+	}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			engine.PlaceOrder(&exchange.OrderRequest{
+				Symbol: "FIL-ETH", Side: exchange.SideSell, Type: exchange.OrderTypeMarket, Quantity: 1,
+			})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			engine.SubscribeDepth("FIL-ETH", make(chan<- *exchange.Depth, 100))
+			engine.SubscribeTrades("FIL-ETH", make(chan<- *exchange.Trade, 100))
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			engine.GetDepth("FIL-ETH", 10)
+		}
+	}()
+
+	wg.Wait()
+}